@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	ageSuffix = ".age"
+	ageKeyEnv = "ENVDIR_AGE_KEY"
+)
+
+// AgeIdentities reads X25519 identities used to decrypt `.age` files, from --age-identity file or ENVDIR_AGE_KEY.
+func (f *Flags) AgeIdentities() ([]age.Identity, error) {
+	if f.AgeIdentity != "" {
+		identityFile, err := os.Open(f.AgeIdentity)
+		if err != nil {
+			return nil, fmt.Errorf("reading age identity: %w", err)
+		}
+		defer identityFile.Close()
+
+		identities, err := age.ParseIdentities(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("parsing age identity `%s`: %w", f.AgeIdentity, err)
+		}
+
+		return identities, nil
+	}
+
+	if ageKey := os.Getenv(ageKeyEnv); ageKey != "" {
+		// parse errors are not wrapped, as they could contain parts of the key
+		identities, err := age.ParseIdentities(strings.NewReader(ageKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age identity in %s", ageKeyEnv)
+		}
+
+		return identities, nil
+	}
+
+	return nil, fmt.Errorf("missing age identity, set --age-identity or %s", ageKeyEnv)
+}
+
+// decryptAge decrypts both binary and ASCII armored age files.
+func decryptAge(data []byte, identities []age.Identity) ([]byte, error) {
+	var encrypted io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		encrypted = armor.NewReader(encrypted)
+	}
+
+	decrypted, err := age.Decrypt(encrypted, identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(decrypted)
+}
+
+func encryptAge(data []byte, recipients []age.Recipient) ([]byte, error) {
+	var encrypted bytes.Buffer
+
+	armorWriter := armor.NewWriter(&encrypted)
+
+	encryptWriter, err := age.Encrypt(armorWriter, recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := encryptWriter.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := encryptWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := armorWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	encrypted.WriteByte('\n')
+
+	return encrypted.Bytes(), nil
+}
+
+type ageRecipientsValue []age.Recipient
+
+func (r *ageRecipientsValue) String() string {
+	return ""
+}
+
+func (r *ageRecipientsValue) Set(value string) error {
+	recipient, err := age.ParseX25519Recipient(value)
+	if err != nil {
+		return err
+	}
+
+	*r = append(*r, recipient)
+
+	return nil
+}
+
+// Encrypt writes a single variable to an env directory as an ASCII armored `.age` file. Without recipients, it is
+// encrypted to the identity envdir decrypts with.
+func (c Cmd) Encrypt(args []string) int {
+	var dir string
+
+	var recipients ageRecipientsValue
+
+	flags := &Flags{}
+	mode := fileModeValue(0600)
+	flagSet := c.newSubcommandFlagSet("encrypt")
+	c.dirFlag(flagSet, &dir)
+	flagSet.Var(&mode, "m", "Permissions of written files (octal)")
+	flagSet.Var(&recipients, "r", "Encrypt to age recipient (repeatable)")
+	flagSet.StringVar(&flags.AgeIdentity, "i", flags.Getenv("ENVDIR_AGE_IDENTITY", ""), "Encrypt to recipient of age identity file")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if flagSet.NArg() < 1 || flagSet.NArg() > 2 {
+		logger.Error("encrypt requires variable name and optional value", LogFields{"args": flagSet.Args()})
+
+		return 2
+	}
+
+	envVar := EnvVar{Name: flagSet.Arg(0), Value: flagSet.Arg(1)}
+
+	if err := validateEnvName(envVar.Name); err != nil {
+		logger.Error("error validating variable", LogFields{"err": err.Error()})
+
+		return 2
+	}
+
+	if len(recipients) == 0 {
+		identities, err := flags.AgeIdentities()
+		if err != nil {
+			logger.Error("encrypt requires recipient", LogFields{"err": err.Error()})
+
+			return 2
+		}
+
+		for _, identity := range identities {
+			if x25519Identity, ok := identity.(*age.X25519Identity); ok {
+				recipients = append(recipients, x25519Identity.Recipient())
+			}
+		}
+	}
+
+	if flagSet.NArg() == 1 {
+		envValue, err := c.readValue(envVar.Name)
+		if err != nil {
+			logger.Error("error reading value", LogFields{"err": err.Error()})
+
+			return 1
+		}
+
+		envVar.Value = envValue
+	}
+
+	encrypted, err := encryptAge(encodeEnvValue(envVar.Value), recipients)
+	if err != nil {
+		logger.Error("error encrypting value", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error("error writing variables to directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	// files of a published directory are read through `..data`, so a new snapshot has to be published instead
+	if isDataDirLayout(dir) {
+		err = updateDataDir(dir, []dataFile{{Name: envVar.Name + ageSuffix, Data: encrypted, Mode: os.FileMode(mode)}}, nil, logger)
+	} else {
+		err = writeFileAtomic(filepath.Join(dir, envVar.Name+ageSuffix), encrypted, os.FileMode(mode))
+	}
+
+	if err != nil {
+		logger.Error("error writing variables to directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	logger.Info("wrote encrypted variable to directory", LogFields{"name": envVar.Name, "dir": dir})
+
+	return 0
+}
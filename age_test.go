@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func writeAgeIdentity(t *testing.T) (*age.X25519Identity, string) {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("error generating identity: %v", err)
+	}
+
+	identityPath := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(identityPath, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("error writing identity: %v", err)
+	}
+
+	return identity, identityPath
+}
+
+func TestCmd_Encrypt(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	identity, identityPath := writeAgeIdentity(t)
+	_, otherIdentityPath := writeAgeIdentity(t)
+
+	encryptedDir := func(t *testing.T, encryptArgs ...string) string {
+		t.Helper()
+
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := t.TempDir()
+
+		os.Args = append([]string{"envdir", "@encrypt", "-d", dir}, encryptArgs...)
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		return dir
+	}
+
+	t.Run("it decrypts variables with identity file", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := encryptedDir(t, "-i", identityPath, "SECRET", "s3cr3t value")
+
+		encryptedData, _ := os.ReadFile(filepath.Join(dir, "SECRET.age"))
+		if !strings.HasPrefix(string(encryptedData), "-----BEGIN AGE ENCRYPTED FILE-----") || strings.Contains(string(encryptedData), "s3cr3t") {
+			t.Errorf("expected armored encrypted file, got:\n%s", encryptedData)
+		}
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "debug", "--age-identity", identityPath, "sh", "-c", `echo "$SECRET"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "s3cr3t value\n") || strings.Count(cmdStdout.String(), "s3cr3t") != 1 {
+			t.Errorf("expected decrypted value, which is not logged, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it decrypts variables with key from environment", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := encryptedDir(t, "-r", identity.Recipient().String(), "SECRET", "s3cr3t")
+		t.Setenv(ageKeyEnv, identity.String())
+
+		os.Args = []string{"envdir", "-d", dir, "sh", "-c", `echo "$SECRET $ENVDIR_AGE_KEY"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "s3cr3t \n" {
+			t.Errorf("expected decrypted value without age key, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails with wrong identity", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := encryptedDir(t, "-i", identityPath, "SECRET", "s3cr3t")
+
+		os.Args = []string{"envdir", "-d", dir, "--age-identity", otherIdentityPath, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), filepath.Join(dir, "SECRET.age")) {
+			t.Errorf("expected file name in log, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails without identity", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := encryptedDir(t, "-i", identityPath, "SECRET", "s3cr3t")
+
+		os.Args = []string{"envdir", "-d", dir, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails if variable is also set in plain file", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := encryptedDir(t, "-i", identityPath, "SECRET", "s3cr3t")
+		if err := os.WriteFile(filepath.Join(dir, "SECRET"), []byte("plain\n"), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+
+		os.Args = []string{"envdir", "-d", dir, "--age-identity", identityPath, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it publishes new snapshot of published directory", func(t *testing.T) {
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		dir := t.TempDir()
+
+		os.Args = []string{"envdir", "@publish", "-d", dir}
+		if exitCode := NewCmd(strings.NewReader("HOST=localhost\n"), &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		dataDir, _ := os.Readlink(filepath.Join(dir, dataDirLink))
+
+		os.Args = []string{"envdir", "@encrypt", "-d", dir, "-i", identityPath, "SECRET", "s3cr3t"}
+		if exitCode := NewCmd(&bytes.Buffer{}, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		if newDataDir, _ := os.Readlink(filepath.Join(dir, dataDirLink)); newDataDir == dataDir {
+			t.Errorf("expected new data directory to be published, got %q", newDataDir)
+		}
+
+		if target, err := os.Readlink(filepath.Join(dir, "SECRET.age")); err != nil || target != filepath.Join(dataDirLink, "SECRET.age") {
+			t.Errorf("expected SECRET.age symlink to ..data, got %q (%v)", target, err)
+		}
+
+		cmdStdout.Reset()
+
+		os.Args = []string{"envdir", "-d", dir, "--age-identity", identityPath, "sh", "-c", `echo "$HOST $SECRET"`}
+		if exitCode := NewCmd(&bytes.Buffer{}, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "localhost s3cr3t\n" {
+			t.Errorf("expected published and encrypted variables, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it requires recipient", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@encrypt", "-d", t.TempDir(), "SECRET", "s3cr3t"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
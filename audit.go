@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AuditVariable struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	HMAC   string `json:"hmac"`
+	Memfd  bool   `json:"memfd,omitempty"`
+}
+
+// AuditRecord describes a single run. Values are recorded only as HMAC-SHA256 with a secret key, so they can be
+// compared with known values by the key owner, but not recovered.
+type AuditRecord struct {
+	Time      string          `json:"time"`
+	Command   []string        `json:"command"`
+	UID       int             `json:"uid"`
+	User      string          `json:"user,omitempty"`
+	Dir       string          `json:"dir"`
+	Variables []AuditVariable `json:"variables"`
+}
+
+func loadAuditKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("missing audit key, set --audit-key-file")
+	}
+
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading audit key: %w", err)
+	}
+
+	key = []byte(strings.TrimSuffix(string(key), "\n"))
+	if len(key) == 0 {
+		return nil, errors.New("empty audit key")
+	}
+
+	return key, nil
+}
+
+func NewAuditRecord(cmd *exec.Cmd, flags *Flags, loaded []LoadedEnv, key []byte) AuditRecord {
+	record := AuditRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Command:   append([]string{cmd.Path}, cmd.Args[1:]...),
+		UID:       os.Getuid(),
+		User:      flags.User,
+		Dir:       flags.Dir,
+		Variables: make([]AuditVariable, 0, len(loaded)),
+	}
+
+	for _, loadedEnv := range loaded {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(loadedEnv.Value))
+
+		record.Variables = append(record.Variables, AuditVariable{
+			Name:   loadedEnv.Name,
+			Source: loadedEnv.Source,
+			HMAC:   hex.EncodeToString(mac.Sum(nil)),
+			Memfd:  loadedEnv.Memfd,
+		})
+	}
+
+	return record
+}
+
+// openAuditTarget opens copy of file descriptor, if target is a number, or file for appending otherwise, so it can be
+// closed without closing descriptors envdir still uses, like its own stdout.
+func openAuditTarget(target string) (*os.File, error) {
+	if fd, err := strconv.Atoi(target); err == nil && fd >= 0 {
+		dupFd, err := dupAuditFd(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		return os.NewFile(uintptr(dupFd), "audit"), nil
+	}
+
+	return os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// writeAuditRecord writes the record as a single JSON line, synced to disk, before the command is started. The file
+// is closed afterwards, so it is not inherited by the command.
+func writeAuditRecord(target string, record AuditRecord) error {
+	auditFile, err := openAuditTarget(target)
+	if err != nil {
+		return fmt.Errorf("opening audit target: %w", err)
+	}
+	defer auditFile.Close()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := auditFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing audit record: %w", err)
+	}
+
+	// pipes and sockets cannot be synced
+	if fileInfo, err := auditFile.Stat(); err == nil && fileInfo.Mode().IsRegular() {
+		if err := auditFile.Sync(); err != nil {
+			return fmt.Errorf("syncing audit record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func auditRun(cmd *exec.Cmd, flags *Flags, loaded []LoadedEnv) error {
+	key, err := loadAuditKey(flags.AuditKeyFile)
+	if err != nil {
+		return err
+	}
+
+	return writeAuditRecord(flags.Audit, NewAuditRecord(cmd, flags, loaded, key))
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func dupAuditFd(_ int) (int, error) {
+	return -1, errors.New("writing audit record to file descriptor is not supported on this platform")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmd_Audit(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	keyPath := filepath.Join(t.TempDir(), "audit.key")
+	if err := os.WriteFile(keyPath, []byte("k3y\n"), 0600); err != nil {
+		t.Fatalf("error writing audit key: %v", err)
+	}
+
+	dir := writeEnvDir(t, map[string]string{"PASSWORD": "s3cr3t\n", "HOST": "localhost\n"})
+
+	t.Run("it appends audit record before running command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		auditPath := filepath.Join(t.TempDir(), "audit.log")
+
+		for i := 0; i < 2; i++ {
+			os.Args = []string{"envdir", "-d", dir, "--audit", auditPath, "--audit-key-file", keyPath, "--memfd", "PASSWORD",
+				"sh", "-c", `test -s "$0" && exit 7`, auditPath}
+			if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 7 {
+				t.Fatalf("expected audit record before command, got %d:\n%s", exitCode, cmdStdout.String())
+			}
+		}
+
+		auditData, _ := os.ReadFile(auditPath)
+		if strings.Contains(string(auditData), "s3cr3t") {
+			t.Errorf("expected no plaintext in audit record, got:\n%s", auditData)
+		}
+
+		auditLines := strings.Split(strings.TrimSpace(string(auditData)), "\n")
+		if len(auditLines) != 2 {
+			t.Fatalf("expected record per run, got:\n%s", auditData)
+		}
+
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(auditLines[0]), &record); err != nil {
+			t.Fatalf("expected JSON record, got %v", err)
+		}
+
+		mac := hmac.New(sha256.New, []byte("k3y"))
+		mac.Write([]byte("s3cr3t"))
+
+		expectedVariables := []AuditVariable{
+			{Name: "HOST", Source: filepath.Join(dir, "HOST"), HMAC: record.Variables[0].HMAC},
+			{Name: "PASSWORD", Source: filepath.Join(dir, "PASSWORD"), HMAC: hex.EncodeToString(mac.Sum(nil)), Memfd: true},
+		}
+
+		if record.Dir != dir || record.UID != os.Getuid() || record.Time == "" || len(record.Command) != 4 ||
+			len(record.Variables) != 2 || record.Variables[0] != expectedVariables[0] || record.Variables[1] != expectedVariables[1] {
+			t.Errorf("unexpected audit record %+v", record)
+		}
+	})
+
+	t.Run("it refuses to run without audit key", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		auditPath := filepath.Join(t.TempDir(), "audit.log")
+
+		os.Args = []string{"envdir", "-d", dir, "--audit", auditPath, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if _, err := os.Stat(auditPath); !os.IsNotExist(err) {
+			t.Errorf("expected no audit record, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// dupAuditFd duplicates descriptor given as audit target, so closing the copy leaves the original open. The original
+// is marked close-on-exec too, unless it is a standard stream, so the command cannot append records on its own.
+func dupAuditFd(fd int) (int, error) {
+	dupFd, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	if fd > 2 {
+		syscall.CloseOnExec(fd)
+	}
+
+	return dupFd, nil
+}
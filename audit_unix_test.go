@@ -0,0 +1,87 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCmd_AuditFd(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	keyPath := t.TempDir() + "/audit.key"
+	_ = os.WriteFile(keyPath, []byte("k3y"), 0600)
+
+	t.Run("it writes audit record to descriptor without passing it to command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("error creating pipe: %v", err)
+		}
+		defer reader.Close()
+
+		// descriptors created by Go are close-on-exec already, so the test passes one inherited like from shell
+		auditFd, _ := unix.Dup(int(writer.Fd()))
+		_ = writer.Close()
+		defer unix.Close(auditFd)
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--audit", strconv.Itoa(auditFd), "--audit-key-file", keyPath,
+			"sh", "-c", `echo forged >&$0`, strconv.Itoa(auditFd)}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode == 0 {
+			t.Fatalf("expected command to fail writing to audit descriptor:\n%s", cmdStdout.String())
+		}
+
+		_ = unix.Close(auditFd)
+
+		auditData := make([]byte, 4096)
+		auditLen, _ := reader.Read(auditData)
+
+		if !strings.HasPrefix(string(auditData[:auditLen]), `{"time":`) || strings.Count(string(auditData[:auditLen]), "\n") != 1 {
+			t.Errorf("expected only audit record in pipe, got %q", auditData[:auditLen])
+		}
+	})
+
+	t.Run("it keeps stdout open after writing audit record to it", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("error creating pipe: %v", err)
+		}
+		defer reader.Close()
+
+		stdoutFd, _ := unix.Dup(1)
+		_ = unix.Dup2(int(writer.Fd()), 1)
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--audit", "1", "--audit-key-file", keyPath, "true"}
+		exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute()
+		_, writeErr := os.Stdout.WriteString("still open\n")
+
+		_ = unix.Dup2(stdoutFd, 1)
+		_ = unix.Close(stdoutFd)
+		_ = writer.Close()
+
+		if exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if writeErr != nil {
+			t.Fatalf("expected stdout to stay open, got %v", writeErr)
+		}
+
+		auditData := make([]byte, 4096)
+		auditLen, _ := reader.Read(auditData)
+
+		if !strings.HasPrefix(string(auditData[:auditLen]), `{"time":`) || !strings.HasSuffix(string(auditData[:auditLen]), "}\nstill open\n") {
+			t.Errorf("expected audit record followed by output in stdout, got %q", auditData[:auditLen])
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// capabilityNames lists Linux capabilities, indexed by their numbers.
+var capabilityNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID",
+	"CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN",
+	"CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE", "CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+// parseCapability accepts capability names with or without `CAP_` prefix, case insensitive.
+func parseCapability(name string) (int, error) {
+	canonicalName := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(canonicalName, "CAP_") {
+		canonicalName = "CAP_" + canonicalName
+	}
+
+	for capability, capabilityName := range capabilityNames {
+		if capabilityName == canonicalName {
+			return capability, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown capability %q", name)
+}
+
+// capabilityListValue collects comma separated capabilities, from any number of flags.
+type capabilityListValue struct {
+	target  *[]string
+	replace bool
+}
+
+func (c *capabilityListValue) replaceOnSet() {
+	c.replace = true
+}
+
+func (c *capabilityListValue) Set(value string) error {
+	if c.replace {
+		*c.target, c.replace = nil, false
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		capability, err := parseCapability(name)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(*c.target, capabilityNames[capability]) {
+			*c.target = append(*c.target, capabilityNames[capability])
+		}
+	}
+
+	return nil
+}
+
+func (c *capabilityListValue) String() string {
+	if c.target == nil {
+		return ""
+	}
+
+	return strings.Join(*c.target, ",")
+}
+
+func (c *capabilityListValue) Get() any {
+	return *c.target
+}
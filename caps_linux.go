@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func getCapabilities() ([2]unix.CapUserData, error) {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+
+	err := unix.Capget(&header, &data[0])
+
+	return data, err
+}
+
+// lastCapability returns the highest capability supported by the kernel.
+func lastCapability() int {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return len(capabilityNames) - 1
+	}
+
+	capability, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return len(capabilityNames) - 1
+	}
+
+	return capability
+}
+
+func setupNoNewPrivs(setup *ProcessSetup) error {
+	setup.OnThread(func() error {
+		return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	})
+
+	return nil
+}
+
+// setupCapabilities limits capabilities of the subprocess to the kept ones. Bounding and inheritable sets are per
+// thread, so they are reduced on the forking thread only, leaving envdir privileged enough to finish the setup. Kept
+// capabilities are all the subprocess gets after exec: root gets them from the bounding set, other users get them only
+// through the ambient set, if it is enabled.
+func setupCapabilities(cmd *exec.Cmd, setup *ProcessSetup, keep []string, ambient bool, logger *Logger) error {
+	if !hasEffectiveCapability(unix.CAP_SETPCAP) {
+		return errors.New("dropping capabilities requires CAP_SETPCAP")
+	}
+
+	current, err := getCapabilities()
+	if err != nil {
+		return fmt.Errorf("reading capabilities: %w", err)
+	}
+
+	var keepMask [2]uint32
+
+	keepCapabilities := make(map[int]bool, len(keep))
+	for _, name := range keep {
+		capability, err := parseCapability(name)
+		if err != nil {
+			return err
+		}
+
+		if current[capability/32].Permitted&(1<<(capability%32)) == 0 {
+			return fmt.Errorf("cannot keep %s, which envdir does not have", name)
+		}
+
+		keepCapabilities[capability] = true
+		keepMask[capability/32] |= 1 << (capability % 32)
+
+		if ambient {
+			if cmd.SysProcAttr == nil {
+				cmd.SysProcAttr = &syscall.SysProcAttr{}
+			}
+
+			cmd.SysProcAttr.AmbientCaps = append(cmd.SysProcAttr.AmbientCaps, uintptr(capability))
+		}
+	}
+
+	logger.Info("dropping capabilities", LogFields{"keep": strings.Join(keep, ","), "ambient": ambient})
+
+	setup.OnThread(func() error {
+		for capability := 0; capability <= lastCapability(); capability++ {
+			if keepCapabilities[capability] {
+				continue
+			}
+
+			if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil {
+				return fmt.Errorf("dropping %s from bounding set: %w", capabilityName(capability), err)
+			}
+		}
+
+		header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+		data, err := getCapabilities()
+		if err != nil {
+			return fmt.Errorf("reading capabilities: %w", err)
+		}
+
+		data[0].Inheritable &= keepMask[0]
+		data[1].Inheritable &= keepMask[1]
+
+		if err := unix.Capset(&header, &data[0]); err != nil {
+			return fmt.Errorf("dropping inheritable capabilities: %w", err)
+		}
+
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+			return fmt.Errorf("dropping ambient capabilities: %w", err)
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
+func capabilityName(capability int) string {
+	if capability < len(capabilityNames) {
+		return capabilityNames[capability]
+	}
+
+	return "capability " + strconv.Itoa(capability)
+}
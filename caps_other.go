@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+func setupNoNewPrivs(_ *ProcessSetup) error {
+	return errProcessSetupNotSupported
+}
+
+func setupCapabilities(_ *exec.Cmd, _ *ProcessSetup, _ []string, _ bool, _ *Logger) error {
+	return errProcessSetupNotSupported
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_ParseCapability(t *testing.T) {
+	var tests = []struct {
+		name               string
+		expectedCapability int
+	}{
+		{"CAP_CHOWN", 0},
+		{"net_bind_service", 10},
+		{"Cap_Sys_Admin", 21},
+		{" cap_checkpoint_restore ", 40},
+	}
+
+	for _, tt := range tests {
+		capability, err := parseCapability(tt.name)
+		if err != nil || capability != tt.expectedCapability {
+			t.Errorf("expected capability %d for %q, got %d (%v)", tt.expectedCapability, tt.name, capability, err)
+		}
+	}
+
+	for _, name := range []string{"", "CAP_", "cap_everything", "10"} {
+		if _, err := parseCapability(name); err == nil {
+			t.Errorf("expected error for %q, got none", name)
+		}
+	}
+}
+
+func Test_CapabilityListValue(t *testing.T) {
+	var capabilities []string
+	value := &capabilityListValue{target: &capabilities}
+
+	for _, list := range []string{"net_bind_service,chown", "CAP_NET_BIND_SERVICE", "kill"} {
+		if err := value.Set(list); err != nil {
+			t.Fatalf("expected no error for %q, got %v", list, err)
+		}
+	}
+
+	if value.String() != "CAP_NET_BIND_SERVICE,CAP_CHOWN,CAP_KILL" {
+		t.Errorf("expected deduplicated capabilities, got %q", value.String())
+	}
+}
+
+func TestCmd_Capabilities(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	const statusScript = `grep -E "^(Cap|NoNewPrivs)" /proc/$$/status`
+
+	t.Run("it sets no_new_privs for command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if runtime.GOOS != "linux" {
+			t.Skip("no_new_privs is supported on linux only")
+		}
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--no-new-privs", "sh", "-c", statusScript}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "NoNewPrivs:\t1\n") {
+			t.Errorf("expected no_new_privs to be set for command, got:\n%s", cmdStdout.String())
+		}
+
+		cmdStdout.Reset()
+		os.Args = []string{"envdir", "-d", t.TempDir(), "sh", "-c", statusScript}
+
+		cmd = NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 || !strings.Contains(cmdStdout.String(), "NoNewPrivs:\t0\n") {
+			t.Errorf("expected no_new_privs not to leak to next command, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	var tests = []struct {
+		name           string
+		args           []string
+		expectedStatus []string
+	}{
+		{
+			"it drops all capabilities of command",
+			[]string{"--drop-caps"},
+			[]string{"CapInh:\t0000000000000000", "CapPrm:\t0000000000000000", "CapEff:\t0000000000000000", "CapBnd:\t0000000000000000", "CapAmb:\t0000000000000000"},
+		},
+		{
+			"it keeps listed capabilities of command",
+			[]string{"--cap-keep", "net_bind_service,chown"},
+			[]string{"CapInh:\t0000000000000000", "CapPrm:\t0000000000000401", "CapEff:\t0000000000000401", "CapBnd:\t0000000000000401", "CapAmb:\t0000000000000000"},
+		},
+		{
+			"it drops capabilities when switching user",
+			[]string{"--user", "4321", "--cap-keep", "net_bind_service"},
+			[]string{"CapInh:\t0000000000000000", "CapPrm:\t0000000000000000", "CapEff:\t0000000000000000", "CapBnd:\t0000000000000400", "CapAmb:\t0000000000000000"},
+		},
+		{
+			"it keeps ambient capabilities when switching user",
+			[]string{"--user", "4321", "--cap-keep", "net_bind_service", "--ambient-caps"},
+			[]string{"CapInh:\t0000000000000400", "CapPrm:\t0000000000000400", "CapEff:\t0000000000000400", "CapBnd:\t0000000000000400", "CapAmb:\t0000000000000400"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+			if runtime.GOOS != "linux" {
+				t.Skip("capabilities are supported on linux only")
+			}
+
+			if os.Geteuid() != 0 {
+				t.Skip("dropping capabilities requires root")
+			}
+
+			os.Args = append(append([]string{"envdir", "-d", t.TempDir()}, tt.args...), "sh", "-c", statusScript)
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 0 {
+				t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+			}
+
+			for _, expectedLine := range tt.expectedStatus {
+				if !strings.Contains(cmdStdout.String(), expectedLine+"\n") {
+					t.Errorf("expected %q in command status, got:\n%s", expectedLine, cmdStdout.String())
+				}
+			}
+		})
+	}
+
+	t.Run("it fails on unknown capabilities", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--cap-keep", "chown,everything", "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
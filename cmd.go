@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"strings"
 )
 
 var (
@@ -11,6 +16,25 @@ var (
 	date    = "unknown"
 )
 
+// subcommandPrefix marks the first argument as a subcommand, so that programs named like one can still be run.
+const subcommandPrefix = "@"
+
+type Subcommand func(c Cmd, args []string) int
+
+var subcommands = map[string]Subcommand{
+	"config":   Cmd.Config,
+	"diff":     Cmd.Diff,
+	"encrypt":  Cmd.Encrypt,
+	"import":   Cmd.Import,
+	"keygen":   Cmd.Keygen,
+	"lint":     Cmd.Lint,
+	"manifest": Cmd.Manifest,
+	"publish":  Cmd.Publish,
+	"set":      Cmd.Set,
+	"sign":     Cmd.Sign,
+	"unset":    Cmd.Unset,
+}
+
 type Cmd struct {
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -24,20 +48,93 @@ func (c Cmd) ShowVersion() {
 	_, _ = c.Stdout.Write([]byte(`envdir version ` + version + `, build ` + commit + ` (` + date + ")\n"))
 }
 
+func (c Cmd) newSubcommandFlagSet(name string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(os.Args[0]+" "+subcommandPrefix+name, flag.ContinueOnError)
+	flagSet.SetOutput(c.Stderr)
+
+	return flagSet
+}
+
+func (c Cmd) parseSubcommandFlags(flagSet *flag.FlagSet, args []string) (int, bool) {
+	err := flagSet.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0, false
+	}
+
+	if err != nil {
+		return 2, false
+	}
+
+	return 0, true
+}
+
+// subcommandLogFlags reads log options of subcommands from ENVDIR_LOG_FORMAT and ENVDIR_LOG_LEVEL, validated the same
+// way as the main command options. Invalid values are left at defaults.
+func subcommandLogFlags() (*Flags, error) {
+	flags := &Flags{}
+
+	for _, option := range []struct {
+		envName string
+		value   *choiceValue
+	}{
+		{"ENVDIR_LOG_FORMAT", newChoiceValue(&flags.LogFormat, "text", logFormats...)},
+		{"ENVDIR_LOG_LEVEL", newChoiceValue(&flags.LogLevel, "warn", logLevels...)},
+	} {
+		if envValue := os.Getenv(option.envName); envValue != "" {
+			if err := option.value.Set(envValue); err != nil {
+				return flags, fmt.Errorf("invalid value of %s: %w", option.envName, err)
+			}
+		}
+	}
+
+	return flags, nil
+}
+
+func (c Cmd) subcommandLogger() *Logger {
+	flags, _ := subcommandLogFlags()
+
+	return NewLogger(flags, c.Stderr)
+}
+
 func (c Cmd) Execute() int {
+	if len(os.Args) > 1 && strings.HasPrefix(os.Args[1], subcommandPrefix) {
+		name := strings.TrimPrefix(os.Args[1], subcommandPrefix)
+
+		if _, err := subcommandLogFlags(); err != nil {
+			c.subcommandLogger().Error("invalid configuration", LogFields{"err": err.Error()})
+
+			return 2
+		}
+
+		subcommand, ok := subcommands[name]
+		if !ok {
+			c.subcommandLogger().Error("unknown subcommand", LogFields{"subcommand": name})
+
+			return 2
+		}
+
+		return subcommand(c, os.Args[2:])
+	}
+
 	flags := NewFlags(c.Stdout)
 
 	if flags.Help {
 		return 0
 	}
 
+	logger := NewLogger(flags, c.Stdout)
+
+	if flags.Err != nil {
+		logger.Error("invalid configuration", LogFields{"err": flags.Err.Error()})
+
+		return 2
+	}
+
 	if flags.ShowVersion {
 		c.ShowVersion()
 		return 0
 	}
 
-	logger := NewLogger(flags, c.Stdout)
-
 	logger.Debug("using config", LogFields{"dir": flags.Dir, "fail": flags.Fail, "log-level": flags.LogLevel, "log-format": flags.LogFormat})
 
 	if flags.Cmd == "" {
@@ -62,19 +159,104 @@ func (c Cmd) Execute() int {
 	envBuilder := NewEnvBuilder(flags, logger)
 
 	cmd.Env, err = envBuilder.Build()
+	if errors.Is(err, errManifestVerification) {
+		logger.Error("error verifying directory", LogFields{"err": err.Error()})
+
+		return 4
+	}
+
 	if err != nil {
 		logger.Error("error parsing environment variables", LogFields{"err": err.Error()})
 
 		return 3
 	}
 
-	err = cmd.Run()
+	if flags.Hooks != "" {
+		if cmd.Env, err = envBuilder.RunHooks(cmd.Env); err != nil {
+			logger.Error("error running hooks", LogFields{"err": err.Error()})
+
+			return 1
+		}
+	}
+
+	if len(envBuilder.Secrets) > 0 {
+		if err := setupMemfdSecrets(cmd, envBuilder.Secrets, flags.MemfdEnv, logger); err != nil {
+			logger.Error("error passing variables through memfd", LogFields{"err": err.Error()})
+
+			return 3
+		}
+	}
+
+	maskingWriters := make([]*MaskingWriter, 0, 2)
+
+	if flags.Mask {
+		minLength := defaultMaskMinLength
+		if flags.MaskMinLength != nil {
+			minLength = *flags.MaskMinLength
+		}
+
+		values := make([]string, 0, len(envBuilder.Loaded))
+		for _, loaded := range envBuilder.Loaded {
+			values = append(values, loaded.Value)
+		}
+
+		matcher := NewMaskMatcher(maskPatterns(values, minLength, flags.MaskEncoded))
+		maskingWriters = append(maskingWriters, NewMaskingWriter(c.Stdout, matcher), NewMaskingWriter(c.Stderr, matcher))
+		cmd.Stdout, cmd.Stderr = maskingWriters[0], maskingWriters[1]
+	}
+
+	setup, err := setupProcess(cmd, flags, logger)
+	if err != nil {
+		logger.Error("error setting up subprocess", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	if flags.Audit != "" {
+		if err := auditRun(cmd, flags, envBuilder.Loaded); err != nil {
+			logger.Error("error writing audit record", LogFields{"err": err.Error()})
+
+			return 1
+		}
+	}
+
+	// files are consumed as late as possible, so they are kept if the command cannot be set up
+	if err := envBuilder.Consume(); err != nil {
+		logger.Error("error consuming variables", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	err = startProcess(cmd, setup)
+
+	// files passed to subprocess are not needed by envdir anymore
+	for _, extraFile := range cmd.ExtraFiles {
+		_ = extraFile.Close()
+	}
+
+	if err != nil {
+		logger.Error("error running subprocess", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	err = cmd.Wait()
+
+	for _, maskingWriter := range maskingWriters {
+		_ = maskingWriter.Flush()
+	}
 	if exitError, ok := err.(*exec.ExitError); ok {
 		logger.Info("subcommand exited with error", LogFields{"err": err.Error()})
 
 		return exitError.ExitCode()
 	}
 
+	if err != nil {
+		logger.Error("error running subprocess", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
 	return 0
 }
 
@@ -124,6 +124,38 @@ func TestCmd_Success(t *testing.T) {
 			t.Errorf("expected version message, got output:\n%s", output)
 		}
 	})
+
+	t.Run("it runs a program named like a subcommand", func(t *testing.T) {
+		var (
+			cmdStdin  bytes.Buffer
+			cmdStdout bytes.Buffer
+			cmdStderr bytes.Buffer
+		)
+
+		binDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(binDir, "diff"), []byte("#!/bin/sh\necho \"program $*\"\n"), 0755); err != nil {
+			t.Fatalf("error writing program: %v", err)
+		}
+
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		t.Setenv("ENVDIR_DIRECTORY", t.TempDir())
+
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+
+		os.Args = []string{"envdir", "diff", "a", "b"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+
+		if exitCode != 0 {
+			t.Errorf("expected success exit code, got %d, output:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "program a b") {
+			t.Errorf("expected program output, got output:\n%s", cmdStdout.String())
+		}
+	})
 }
 
 func TestCmd_Failure(t *testing.T) {
@@ -255,4 +287,81 @@ func TestCmd_Failure(t *testing.T) {
 			t.Errorf("expected output to return error about missing command, output:\n%s", output)
 		}
 	})
+
+	t.Run("it returns usage error for unknown subcommand", func(t *testing.T) {
+		var (
+			cmdStdin  bytes.Buffer
+			cmdStdout bytes.Buffer
+			cmdStderr bytes.Buffer
+		)
+
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+
+		os.Args = []string{"envdir", "@unknown"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+
+		if exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStderr.String(), `msg="unknown subcommand" subcommand=unknown`) {
+			t.Errorf("expected error about unknown subcommand, got stderr:\n%s", cmdStderr.String())
+		}
+	})
+}
+
+func TestCmd_InvalidConfiguration(t *testing.T) {
+	for _, args := range [][]string{
+		{"envdir", "-ll", "verbose", "true"},
+		{"envdir", "-unknown", "true"},
+		{"envdir", "-v", "-lf", "xml"},
+	} {
+		var (
+			cmdStdin  bytes.Buffer
+			cmdStdout bytes.Buffer
+			cmdStderr bytes.Buffer
+		)
+
+		oldArgs := os.Args
+		os.Args = args
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+		output := cmdStdout.String()
+
+		os.Args = oldArgs
+
+		if exitCode != 2 {
+			t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+		}
+
+		if !strings.Contains(output, `level=ERROR msg="invalid configuration"`) {
+			t.Errorf("expected output to return error about invalid configuration, output:\n%s", output)
+		}
+	}
+}
+
+func TestCmd_InvalidSubcommandLogConfiguration(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for envName, envValue := range map[string]string{"ENVDIR_LOG_LEVEL": "verbose", "ENVDIR_LOG_FORMAT": "xml"} {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		t.Setenv(envName, envValue)
+		os.Args = []string{"envdir", "@diff", t.TempDir(), t.TempDir()}
+
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code for %s=%s, got %d", envName, envValue, exitCode)
+		}
+
+		if !strings.Contains(cmdStderr.String(), `level=ERROR msg="invalid configuration"`) || !strings.Contains(cmdStderr.String(), envName) {
+			t.Errorf("expected error about invalid %s, got stderr:\n%s", envName, cmdStderr.String())
+		}
+
+		t.Setenv(envName, "")
+	}
 }
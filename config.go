@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var defaultConfigPath = "/etc/envdir.yaml"
+
+// ConfigValues holds raw config file values by key. Every value is kept as a list, so options accepting multiple
+// values can be configured with YAML sequences.
+type ConfigValues map[string][]string
+
+func configOption(key string) (ConfigOption, bool) {
+	for _, option := range configOptions {
+		if option.Key == key {
+			return option, true
+		}
+	}
+
+	return ConfigOption{}, false
+}
+
+// configScalar returns scalar value as written in the config file, so e.g. `0027` is not turned into a number.
+func configScalar(key string, node *yaml.Node) (string, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return "", fmt.Errorf("invalid value of `%s` in config file", key)
+	}
+
+	return node.Value, nil
+}
+
+// LoadConfig reads the config file from path. If path is empty, the default config file is used if it exists.
+func LoadConfig(path string) (ConfigValues, error) {
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err != nil {
+			return ConfigValues{}, nil
+		}
+
+		path = defaultConfigPath
+	}
+
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(configData)).Decode(&document); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file `%s`: %w", path, err)
+	}
+
+	if len(document.Content) == 0 {
+		return ConfigValues{}, nil
+	}
+
+	rawConfig := document.Content[0]
+	if rawConfig.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parsing config file `%s`: expected mapping of options", path)
+	}
+
+	config := make(ConfigValues, len(rawConfig.Content)/2)
+
+	for i := 0; i+1 < len(rawConfig.Content); i += 2 {
+		key, rawValue := rawConfig.Content[i].Value, rawConfig.Content[i+1]
+
+		if _, ok := configOption(key); !ok {
+			return nil, fmt.Errorf("unknown key `%s` in config file `%s`", key, path)
+		}
+
+		if _, ok := config[key]; ok {
+			return nil, fmt.Errorf("duplicate key `%s` in config file `%s`", key, path)
+		}
+
+		if rawValue.Kind == yaml.AliasNode {
+			rawValue = rawValue.Alias
+		}
+
+		rawValues := []*yaml.Node{rawValue}
+		if rawValue.Kind == yaml.SequenceNode {
+			rawValues = rawValue.Content
+		}
+
+		config[key] = make([]string, 0, len(rawValues))
+
+		for _, rawValue := range rawValues {
+			value, err := configScalar(key, rawValue)
+			if err != nil {
+				return nil, err
+			}
+
+			config[key] = append(config[key], value)
+		}
+	}
+
+	return config, nil
+}
+
+// Config handles config related commands. `config print` shows the effective configuration, merged from flags,
+// ENVDIR_* variables, config file and defaults.
+func (c Cmd) Config(args []string) int {
+	logger := c.subcommandLogger()
+
+	if len(args) == 0 || args[0] != "print" {
+		logger.Error("unknown config command, expected `config print`", LogFields{"args": args})
+
+		return 2
+	}
+
+	flags := newFlagsFromArgs(args[1:], c.Stderr)
+	if flags.Help {
+		return 0
+	}
+
+	if flags.Err != nil {
+		logger.Error("invalid configuration", LogFields{"err": flags.Err.Error()})
+
+		return 2
+	}
+
+	config := make(map[string]any, len(configOptions))
+	for _, option := range configOptions {
+		config[option.Key] = flags.ConfigValue(option)
+	}
+
+	_ = yaml.NewEncoder(c.Stdout).Encode(config)
+
+	return 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, config string) string {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "envdir.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("error creating config file: %v", err)
+	}
+
+	return configPath
+}
+
+func Test_LoadConfig(t *testing.T) {
+	t.Run("it loads values from config file", func(t *testing.T) {
+		config, err := LoadConfig(writeConfigFile(t, "dir: /config\nfail: true\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if config["dir"][0] != "/config" || config["fail"][0] != "true" {
+			t.Errorf("unexpected config values: %v", config)
+		}
+	})
+
+	t.Run("it keeps values as written", func(t *testing.T) {
+		config, err := LoadConfig(writeConfigFile(t, "umask: 0027\nmask-min-length: 0x10\nfs-ro: [/opt, 010]\nuser: &user 1e3\nchdir: *user\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectedConfig := ConfigValues{"umask": {"0027"}, "mask-min-length": {"0x10"}, "fs-ro": {"/opt", "010"}, "user": {"1e3"}, "chdir": {"1e3"}}
+		if fmt.Sprint(config) != fmt.Sprint(expectedConfig) {
+			t.Errorf("expected %v, got %v", expectedConfig, config)
+		}
+	})
+
+	t.Run("it auto-discovers default config file", func(t *testing.T) {
+		oldDefaultConfigPath := defaultConfigPath
+		defer func() { defaultConfigPath = oldDefaultConfigPath }()
+
+		defaultConfigPath = writeConfigFile(t, "paranoid: true\n")
+
+		config, err := LoadConfig("")
+		if err != nil || config["paranoid"][0] != "true" {
+			t.Errorf("expected default config file to be loaded, got %v (%v)", config, err)
+		}
+
+		defaultConfigPath = "/non-existing-config.yaml"
+
+		config, err = LoadConfig("")
+		if err != nil || len(config) != 0 {
+			t.Errorf("expected missing default config file to be ignored, got %v (%v)", config, err)
+		}
+	})
+
+	t.Run("it fails on invalid config files", func(t *testing.T) {
+		var tests = []struct {
+			config        string
+			expectedError string
+		}{
+			{"unknown: value\n", "unknown key `unknown`"},
+			{"dir:\n  nested: value\n", "invalid value of `dir`"},
+			{"dir: [", "parsing config file"},
+			{"dir: ~\n", "invalid value of `dir`"},
+			{"dir: /a\ndir: /b\n", "duplicate key `dir`"},
+			{"- dir\n", "expected mapping of options"},
+		}
+
+		for _, tt := range tests {
+			_, err := LoadConfig(writeConfigFile(t, tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error %q for config %q, got %v", tt.expectedError, tt.config, err)
+			}
+		}
+
+		if _, err := LoadConfig("/non-existing-config.yaml"); err == nil {
+			t.Error("expected error for missing explicit config file, got none")
+		}
+	})
+}
+
+func Test_FlagsFromConfig(t *testing.T) {
+	configPath := writeConfigFile(t, "dir: /from-file\nfail: true\nlog-format: json\nlog-level: info\n")
+
+	t.Setenv("ENVDIR_CONFIG", configPath)
+	t.Setenv("ENVDIR_LOG_FORMAT", "text")
+	t.Setenv("ENVDIR_LOG_LEVEL", "")
+
+	flags := newFlagsFromArgs([]string{"-ll", "debug", "true"}, &flagsOutput)
+
+	var tests = []struct {
+		flagName      string
+		flagValue     any
+		expectedValue any
+	}{
+		{"d", flags.Dir, "/from-file"},
+		{"f", flags.Fail, true},
+		{"p", flags.Paranoid, false},
+		{"lf", flags.LogFormat, "text"},
+		{"ll", flags.LogLevel, "debug"},
+	}
+
+	for _, tt := range tests {
+		if tt.flagValue != tt.expectedValue {
+			t.Errorf("invalid value of flag %q: expected %v, got %v", tt.flagName, tt.expectedValue, tt.flagValue)
+		}
+	}
+
+	if flags.Err != nil {
+		t.Errorf("expected no error, got %v", flags.Err)
+	}
+
+	t.Setenv("ENVDIR_CONFIG", writeConfigFile(t, "fail: maybe\n"))
+
+	if flags := newFlagsFromArgs([]string{"true"}, &flagsOutput); flags.Err == nil {
+		t.Error("expected error for invalid config value, got none")
+	}
+}
+
+func TestCmd_ConfigPrint(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it prints effective config", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		t.Setenv("ENVDIR_PARANOID", "true")
+		os.Args = []string{"envdir", "@config", "print", "-config", writeConfigFile(t, "dir: /from-file\n"), "-ll", "error"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		for _, expectedLine := range []string{"dir: /from-file", "fail: false", "log-format: text", "log-level: error", "paranoid: true"} {
+			if !strings.Contains("\n"+cmdStdout.String(), "\n"+expectedLine+"\n") {
+				t.Errorf("expected %q in config output:\n%s", expectedLine, cmdStdout.String())
+			}
+		}
+	})
+
+	t.Run("it loads printed config back", func(t *testing.T) {
+		var printed [2]bytes.Buffer
+
+		configPath := writeConfigFile(t, "")
+
+		for i, args := range [][]string{{"-umask", "0027", "-d", "/from-flags"}, {"-config", configPath}} {
+			var cmdStdin, cmdStderr bytes.Buffer
+
+			os.Args = append([]string{"envdir", "@config", "print"}, args...)
+
+			cmd := NewCmd(&cmdStdin, &printed[i], &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 0 {
+				t.Fatalf("expected success exit code for %v, got %d:\n%s", args, exitCode, cmdStderr.String())
+			}
+
+			_ = os.WriteFile(configPath, printed[i].Bytes(), 0644)
+		}
+
+		if printed[0].String() != printed[1].String() || !strings.Contains(printed[1].String(), "umask: \"0027\"") {
+			t.Errorf("expected the same config after loading it back, got:\n%s\n%s", printed[0].String(), printed[1].String())
+		}
+	})
+
+	t.Run("it fails on invalid config", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		for _, args := range [][]string{
+			{"envdir", "@config"},
+			{"envdir", "@config", "print", "-config", writeConfigFile(t, "unknown: true\n")},
+			{"envdir", "-config", writeConfigFile(t, "unknown: true\n"), "true"},
+		} {
+			os.Args = args
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 2 {
+				t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+			}
+		}
+	})
+}
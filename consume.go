@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// shredFile overwrites file contents with zeros before it is removed. It is best effort only, as copy-on-write and
+// journaling filesystems can keep old blocks anyway. Only regular files are overwritten, a symlink is left to be
+// unlinked, so its target (possibly outside of env directory) is never touched.
+func shredFile(path string) error {
+	linkInfo, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if !linkInfo.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the file could be replaced with a symlink in the meantime
+	if !os.SameFile(linkInfo, fileInfo) {
+		return errors.New("file replaced while overwriting")
+	}
+
+	if _, err := file.Write(make([]byte, fileInfo.Size())); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func consumeFile(path string, shred bool) error {
+	if shred {
+		if err := shredFile(path); err != nil {
+			return fmt.Errorf("overwriting `%s`: %w", path, err)
+		}
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing `%s`: %w", path, err)
+	}
+
+	return nil
+}
+
+// Consume removes directory files of variables matching consume patterns, once the environment is built. Failures
+// are only logged in warn mode, otherwise every file is still tried before an error is returned.
+func (eb *EnvBuilder) Consume() error {
+	failedCount := 0
+
+	for _, envFile := range eb.consumable {
+		if err := consumeFile(envFile.Path, eb.Flags.ConsumeShred); err != nil {
+			failedCount++
+
+			if eb.Flags.ConsumeFailure == "warn" {
+				eb.Logger.Warn("error consuming variable", LogFields{"name": envFile.Name, "err": err.Error()})
+			} else {
+				eb.Logger.Error("error consuming variable", LogFields{"name": envFile.Name, "err": err.Error()})
+			}
+
+			continue
+		}
+
+		eb.Logger.Info("consumed variable", LogFields{"name": envFile.Name, "path": envFile.Path})
+	}
+
+	if failedCount > 0 && eb.Flags.ConsumeFailure != "warn" {
+		return fmt.Errorf("failed to consume %d variables", failedCount)
+	}
+
+	return nil
+}
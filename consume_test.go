@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_ShredFile(t *testing.T) {
+	path := filepath.Join(writeEnvDir(t, map[string]string{"TOKEN": "s3cr3t\n"}), "TOKEN")
+
+	if err := shredFile(path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, make([]byte, 7)) {
+		t.Errorf("expected file to be overwritten with zeros, got %q", data)
+	}
+
+	t.Run("it only removes symlinks", func(t *testing.T) {
+		targetPath := filepath.Join(writeEnvDir(t, map[string]string{"TARGET": "s3cr3t\n"}), "TARGET")
+		linkPath := filepath.Join(t.TempDir(), "TOKEN")
+
+		if err := os.Symlink(targetPath, linkPath); err != nil {
+			t.Fatalf("error creating symlink: %v", err)
+		}
+
+		if err := consumeFile(linkPath, true); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := os.Lstat(linkPath); !os.IsNotExist(err) {
+			t.Errorf("expected symlink to be removed, got %v", err)
+		}
+
+		if data, _ := os.ReadFile(targetPath); string(data) != "s3cr3t\n" {
+			t.Errorf("expected symlink target to be left intact, got %q", data)
+		}
+	})
+}
+
+func Test_Consume(t *testing.T) {
+	var logOutput bytes.Buffer
+
+	// a non-empty directory cannot be removed, the same way as a file on read-only mount
+	unremovablePath := writeEnvDir(t, map[string]string{"A": "a\n"})
+
+	for _, consumeFailure := range []string{"error", "warn"} {
+		t.Run("it handles removal failure in "+consumeFailure+" mode", func(t *testing.T) {
+			removablePath := filepath.Join(writeEnvDir(t, map[string]string{"B": "b\n"}), "B")
+
+			logOutput.Reset()
+			flags := &Flags{ConsumeFailure: consumeFailure}
+			envBuilder := NewEnvBuilder(flags, NewLogger(flags, &logOutput))
+			envBuilder.consumable = []EnvFile{{Name: "A", Path: unremovablePath}, {Name: "B", Path: removablePath}}
+
+			err := envBuilder.Consume()
+			if (err != nil) != (consumeFailure == "error") {
+				t.Errorf("unexpected error %v", err)
+			}
+
+			if _, err := os.Stat(removablePath); !os.IsNotExist(err) {
+				t.Errorf("expected other files to be removed anyway, got %v", err)
+			}
+
+			if !strings.Contains(logOutput.String(), "error consuming variable") || !strings.Contains(logOutput.String(), "name=A") {
+				t.Errorf("expected failure in log, got:\n%s", logOutput.String())
+			}
+		})
+	}
+}
+
+func TestCmd_Consume(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it removes matching files before running command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"BOOTSTRAP_TOKEN": "t0k3n\n", "HOST": "localhost\n"})
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "info", "--consume", "*_TOKEN", "--consume-shred", "sh", "-c",
+			`echo "$BOOTSTRAP_TOKEN $HOST"; ls "$0"`, dir}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "t0k3n localhost\nHOST\n") {
+			t.Errorf("expected consumed variable to be passed, and its file removed, got:\n%s", cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "consumed variable") || !strings.Contains(cmdStdout.String(), "name=BOOTSTRAP_TOKEN") {
+			t.Errorf("expected consumed name in log, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it keeps files if environment cannot be built", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"BOOTSTRAP_TOKEN": "t0k3n\n", "LD_PRELOAD": "evil.so\n"})
+
+		os.Args = []string{"envdir", "-d", dir, "--consume", "*_TOKEN", "--dangerous-vars", "error", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "BOOTSTRAP_TOKEN")); err != nil {
+			t.Errorf("expected file to be kept, got %v", err)
+		}
+	})
+}
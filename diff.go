@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+)
+
+type EnvDiff struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+func (d EnvDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+func (d EnvDiff) Text() string {
+	var text strings.Builder
+
+	for _, section := range []struct {
+		prefix string
+		names  []string
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Modified}} {
+		for _, name := range section.names {
+			text.WriteString(section.prefix + " " + name + "\n")
+		}
+	}
+
+	return text.String()
+}
+
+type envHashes map[string][sha256.Size]byte
+
+func hashEnvFiles(envFiles []EnvFile) envHashes {
+	hashes := make(envHashes, len(envFiles))
+
+	for _, envFile := range envFiles {
+		hashes[envFile.Name] = sha256.Sum256([]byte(envFile.Value()))
+	}
+
+	return hashes
+}
+
+// hashEnviron hashes variables from the current process environment, limited to the names present in filter.
+func hashEnviron(filter envHashes) envHashes {
+	hashes := make(envHashes, len(filter))
+
+	for _, envLine := range os.Environ() {
+		envName, envValue, _ := strings.Cut(envLine, `=`)
+		if _, ok := filter[envName]; ok {
+			hashes[envName] = sha256.Sum256([]byte(envValue))
+		}
+	}
+
+	return hashes
+}
+
+func NewEnvDiff(oldHashes, newHashes envHashes) EnvDiff {
+	diff := EnvDiff{Added: make([]string, 0), Removed: make([]string, 0), Modified: make([]string, 0)}
+
+	for name, newHash := range newHashes {
+		oldHash, ok := oldHashes[name]
+
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case oldHash != newHash:
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+
+	for name := range oldHashes {
+		if _, ok := newHashes[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+
+	return diff
+}
+
+// Diff compares variable names and value hashes between two env directories, or between a directory and
+// the current process environment. It returns 1 if any differences were found, so it can be used in CI.
+func (c Cmd) Diff(args []string) int {
+	var outputFormat string
+
+	flagSet := c.newSubcommandFlagSet("diff")
+	flagSet.StringVar(&outputFormat, "o", "text", "Output format (text/json)")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if outputFormat != "text" && outputFormat != "json" {
+		logger.Error("invalid output format", LogFields{"format": outputFormat})
+
+		return 2
+	}
+
+	dirs := flagSet.Args()
+	if len(dirs) < 1 || len(dirs) > 2 {
+		logger.Error("diff requires one or two directories", LogFields{"args": dirs})
+
+		return 2
+	}
+
+	newEnvFiles, err := readEnvDir(dirs[len(dirs)-1])
+	if err != nil {
+		logger.Error("error reading variables from directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	newHashes := hashEnvFiles(newEnvFiles)
+	oldHashes := hashEnviron(newHashes)
+
+	if len(dirs) == 2 {
+		oldEnvFiles, err := readEnvDir(dirs[0])
+		if err != nil {
+			logger.Error("error reading variables from directory", LogFields{"err": err.Error()})
+
+			return 3
+		}
+
+		oldHashes = hashEnvFiles(oldEnvFiles)
+	}
+
+	diff := NewEnvDiff(oldHashes, newHashes)
+
+	if outputFormat == "json" {
+		_ = json.NewEncoder(c.Stdout).Encode(diff)
+	} else {
+		_, _ = c.Stdout.Write([]byte(diff.Text()))
+	}
+
+	if diff.Empty() {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeEnvDir(t *testing.T, envs map[string]string) string {
+	t.Helper()
+
+	envDir := t.TempDir()
+
+	for envName, envValue := range envs {
+		if err := os.WriteFile(filepath.Join(envDir, envName), []byte(envValue), 0644); err != nil {
+			t.Fatalf("error creating temporary env var file: %v", err)
+		}
+	}
+
+	return envDir
+}
+
+func TestCmd_Diff(t *testing.T) {
+	oldDir := writeEnvDir(t, map[string]string{"KEPT": "same", "CHANGED": "old-secret", "DROPPED": "value"})
+	newDir := writeEnvDir(t, map[string]string{"KEPT": "same\n", "CHANGED": "new-secret", "CREATED": "value"})
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it reports differences between two directories", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@diff", oldDir, newDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+		output := cmdStdout.String()
+
+		if exitCode != 1 {
+			t.Errorf("expected differences exit code, got %d", exitCode)
+		}
+
+		if output != "+ CREATED\n- DROPPED\n~ CHANGED\n" {
+			t.Errorf("unexpected diff output:\n%s", output)
+		}
+
+		if strings.Contains(output, "secret") {
+			t.Errorf("diff output leaks secret values:\n%s", output)
+		}
+	})
+
+	t.Run("it reports differences as json", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@diff", "-o", "json", oldDir, newDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+		output := cmdStdout.String()
+
+		if exitCode != 1 {
+			t.Errorf("expected differences exit code, got %d", exitCode)
+		}
+
+		if output != `{"added":["CREATED"],"removed":["DROPPED"],"modified":["CHANGED"]}`+"\n" {
+			t.Errorf("unexpected diff output:\n%s", output)
+		}
+	})
+
+	t.Run("it compares directory with current environment", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		t.Setenv("KEPT", "same")
+		t.Setenv("CHANGED", "old-secret")
+
+		os.Args = []string{"envdir", "@diff", newDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		exitCode := cmd.Execute()
+		output := cmdStdout.String()
+
+		if exitCode != 1 {
+			t.Errorf("expected differences exit code, got %d", exitCode)
+		}
+
+		if output != "+ CREATED\n~ CHANGED\n" {
+			t.Errorf("unexpected diff output:\n%s", output)
+		}
+	})
+
+	t.Run("it succeeds when there are no differences", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@diff", newDir, newDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d", exitCode)
+		}
+
+		if cmdStdout.Len() != 0 {
+			t.Errorf("expected empty output, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails on invalid arguments", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		for _, args := range [][]string{{"envdir", "@diff"}, {"envdir", "@diff", "-o", "yaml", newDir}} {
+			os.Args = args
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 2 {
+				t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+			}
+		}
+	})
+
+	t.Run("it fails when directory cannot be read", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@diff", "/non-existing-directory", newDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 3 {
+			t.Errorf("expected read error exit code, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStderr.String(), `msg="error reading variables from directory"`) {
+			t.Errorf("expected error about reading directory, got:\n%s", cmdStderr.String())
+		}
+	})
+}
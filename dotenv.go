@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	envNameRegex    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	dotenvLineRegex = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_.-]*)\s*=\s*(.*)$`)
+	dotenvEscapes   = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, `$`)
+)
+
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+func validateEnvName(envName string) error {
+	if !envNameRegex.MatchString(envName) {
+		return fmt.Errorf("invalid variable name `%s`", envName)
+	}
+
+	return nil
+}
+
+func parseDotenvValue(rawValue string) (string, error) {
+	switch {
+	case strings.HasPrefix(rawValue, `'`):
+		value, rest, ok := strings.Cut(rawValue[1:], `'`)
+		if !ok || !isDotenvComment(rest) {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+
+		return value, nil
+	case strings.HasPrefix(rawValue, `"`):
+		for i := 1; i < len(rawValue); i++ {
+			switch rawValue[i] {
+			case '\\':
+				i++
+			case '"':
+				if !isDotenvComment(rawValue[i+1:]) {
+					return "", fmt.Errorf("unexpected characters after double quoted value")
+				}
+
+				return dotenvEscapes.Replace(rawValue[1:i]), nil
+			}
+		}
+
+		return "", fmt.Errorf("unterminated double quoted value")
+	default:
+		if commentIndex := strings.Index(rawValue, " #"); commentIndex >= 0 {
+			rawValue = rawValue[:commentIndex]
+		}
+
+		return strings.TrimSpace(rawValue), nil
+	}
+}
+
+func isDotenvComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// parseDotenv reads `NAME=value` lines, supporting `export` prefixes, comments, and single or double quoted values.
+func parseDotenv(input io.Reader) ([]EnvVar, error) {
+	envVars := make([]EnvVar, 0)
+	scanner := bufio.NewScanner(input)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		matches := dotenvLineRegex.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("line %d: invalid dotenv line", lineNumber)
+		}
+
+		envValue, err := parseDotenvValue(matches[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		envVars = append(envVars, EnvVar{Name: matches[1], Value: envValue})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading dotenv input: %w", err)
+	}
+
+	return envVars, nil
+}
+
+// parseJSONEnv reads a flat JSON object. Numbers and booleans are converted to their textual representation.
+func parseJSONEnv(input io.Reader) ([]EnvVar, error) {
+	var jsonEnvs map[string]any
+
+	decoder := json.NewDecoder(input)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&jsonEnvs); err != nil {
+		return nil, fmt.Errorf("parsing json input: %w", err)
+	}
+
+	envVars := make([]EnvVar, 0, len(jsonEnvs))
+
+	for envName, jsonValue := range jsonEnvs {
+		switch value := jsonValue.(type) {
+		case string:
+			envVars = append(envVars, EnvVar{Name: envName, Value: value})
+		case json.Number, bool:
+			envVars = append(envVars, EnvVar{Name: envName, Value: fmt.Sprint(value)})
+		default:
+			return nil, fmt.Errorf("unsupported json value type for `%s`", envName)
+		}
+	}
+
+	sort.Slice(envVars, func(i, j int) bool { return envVars[i].Name < envVars[j].Name })
+
+	return envVars, nil
+}
+
+// encodeEnvValue returns file contents which envdir reads back as exactly the given value.
+func encodeEnvValue(envValue string) []byte {
+	envData := []byte(envValue)
+	if bytes.HasSuffix(envData, []byte("\n")) {
+		envData = append(envData, '\n')
+	}
+
+	return envData
+}
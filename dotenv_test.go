@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ParseDotenv(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"",
+		"PLAIN=value",
+		"export EXPORTED = exported value # comment",
+		`SINGLE='single # "quoted"'`,
+		`DOUBLE="line1\nline2 \"quoted\"" # comment`,
+		"EMPTY=",
+	}, "\n")
+
+	envVars, err := parseDotenv(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedEnvVars := []EnvVar{
+		{"PLAIN", "value"},
+		{"EXPORTED", "exported value"},
+		{"SINGLE", `single # "quoted"`},
+		{"DOUBLE", "line1\nline2 \"quoted\""},
+		{"EMPTY", ""},
+	}
+
+	if len(envVars) != len(expectedEnvVars) {
+		t.Fatalf("expected %v, got %v", expectedEnvVars, envVars)
+	}
+
+	for i, expectedEnvVar := range expectedEnvVars {
+		if envVars[i] != expectedEnvVar {
+			t.Errorf("expected %v, got %v", expectedEnvVar, envVars[i])
+		}
+	}
+
+	for _, invalidInput := range []string{"NO_VALUE", "1INVALID=name", `UNTERMINATED="value`, `TRAILING='value' junk`} {
+		if _, err := parseDotenv(strings.NewReader(invalidInput)); err == nil {
+			t.Errorf("expected error for %q, got none", invalidInput)
+		}
+	}
+}
+
+func Test_ParseJSONEnv(t *testing.T) {
+	envVars, err := parseJSONEnv(strings.NewReader(`{"STRING": "value", "NUMBER": 42.5, "BOOL": true}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedEnvVars := []EnvVar{{"BOOL", "true"}, {"NUMBER", "42.5"}, {"STRING", "value"}}
+	for i, expectedEnvVar := range expectedEnvVars {
+		if envVars[i] != expectedEnvVar {
+			t.Errorf("expected %v, got %v", expectedEnvVar, envVars[i])
+		}
+	}
+
+	for _, invalidInput := range []string{`["array"]`, `{"NESTED": {}}`, `{"NULL": null}`} {
+		if _, err := parseJSONEnv(strings.NewReader(invalidInput)); err == nil {
+			t.Errorf("expected error for %q, got none", invalidInput)
+		}
+	}
+}
+
+func Test_EncodeEnvValue(t *testing.T) {
+	for _, envValue := range []string{"value", "value\n", "", "multi\nline\n\n"} {
+		if decoded := (EnvFile{Data: encodeEnvValue(envValue)}).Value(); decoded != envValue {
+			t.Errorf("expected value %q to be read back unchanged, got %q", envValue, decoded)
+		}
+	}
+}
@@ -1,21 +1,64 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
+	"path"
+	"slices"
 	"strings"
+
+	"filippo.io/age"
 )
 
 type EnvBuilder struct {
 	Flags  *Flags
 	Logger *Logger
+
+	// Secrets are directory variables matching memfd patterns, which are passed to subprocess outside of environment.
+	Secrets []EnvVar
+	// Loaded are all variables read from directory and SOPS files, including secrets.
+	Loaded []LoadedEnv
+
+	consumable []EnvFile
+}
+
+// LoadedEnv is a variable read by envdir itself, with path of the file it came from.
+type LoadedEnv struct {
+	EnvVar
+	Source string
+	Memfd  bool
+}
+
+// dangerousEnvPatterns match variables, which let anyone able to set them run code in the subprocess, through
+// dynamic loader, shell startup files or interpreter options.
+var dangerousEnvPatterns = []string{
+	"LD_*", "DYLD_*", "GCONV_PATH",
+	"BASH_ENV", "ENV", "BASH_FUNC_*", "SHELLOPTS", "PS4",
+	"PYTHONSTARTUP", "PYTHONPATH", "PYTHONHOME",
+	"NODE_OPTIONS", "NODE_PATH",
+	"PERL5OPT", "PERL5LIB", "PERLLIB",
+	"RUBYOPT", "RUBYLIB",
+	"JAVA_TOOL_OPTIONS", "_JAVA_OPTIONS", "JDK_JAVA_OPTIONS",
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (eb *EnvBuilder) parentEnvs() []string {
 	if !eb.Flags.Paranoid {
-		parentEnvVars := os.Environ()
+		// age key is meant for envdir only, and is never passed to the subprocess
+		parentEnvVars := slices.DeleteFunc(os.Environ(), func(envLine string) bool {
+			return strings.HasPrefix(envLine, ageKeyEnv+`=`)
+		})
 
 		if eb.Logger.LogLevel == slog.LevelDebug {
 			for _, envLine := range parentEnvVars {
@@ -47,35 +90,279 @@ func (eb *EnvBuilder) flagError(err error) ([]string, error) {
 	return make([]string, 0), nil
 }
 
+// checkPerms reports every insecure file, and fails afterwards if strict permissions are enforced.
+func (eb *EnvBuilder) checkPerms(envPaths []string) error {
+	issues, err := checkEnvFilesPerms(envPaths)
+	if err != nil {
+		return fmt.Errorf("checking permissions: %w", err)
+	}
+
+	for _, issue := range issues {
+		if eb.Flags.StrictPerms == "error" {
+			eb.Logger.Error("insecure permissions", LogFields{"path": issue.Path, "reason": issue.Reason})
+		} else {
+			eb.Logger.Warn("insecure permissions", LogFields{"path": issue.Path, "reason": issue.Reason})
+		}
+	}
+
+	if len(issues) > 0 && eb.Flags.StrictPerms == "error" {
+		return fmt.Errorf("found %d insecure permissions", len(issues))
+	}
+
+	return nil
+}
+
+// filterDangerousEnvs reports every dangerous variable, which is not explicitly allowed. They are skipped in warn
+// mode, otherwise an error is returned. Skipped variables are removed from eb.Loaded entries recorded for envLines,
+// starting at loadedFrom, so the same names loaded from other sources are kept.
+func (eb *EnvBuilder) filterDangerousEnvs(envLines []string, source string, loadedFrom int) ([]string, error) {
+	filteredEnvs := make([]string, 0, len(envLines))
+	blockedNames := make([]string, 0)
+
+	for _, envLine := range envLines {
+		envName, _, _ := strings.Cut(envLine, `=`)
+		if !matchesAnyPattern(envName, dangerousEnvPatterns) || matchesAnyPattern(envName, eb.Flags.AllowDangerous) {
+			filteredEnvs = append(filteredEnvs, envLine)
+
+			continue
+		}
+
+		blockedNames = append(blockedNames, envName)
+
+		if eb.Flags.DangerousVars == "warn" {
+			eb.Logger.Warn("skipping dangerous variable", LogFields{"name": envName, "source": source})
+			skipped := slices.DeleteFunc(eb.Loaded[loadedFrom:], func(loaded LoadedEnv) bool { return loaded.Name == envName && !loaded.Memfd })
+			eb.Loaded = eb.Loaded[:loadedFrom+len(skipped)]
+		} else {
+			eb.Logger.Error("dangerous variable", LogFields{"name": envName, "source": source})
+		}
+	}
+
+	if len(blockedNames) > 0 && eb.Flags.DangerousVars != "warn" {
+		return nil, fmt.Errorf("refusing dangerous variables: %s", strings.Join(blockedNames, ", "))
+	}
+
+	return filteredEnvs, nil
+}
+
+// verifyManifest checks files already read against the manifest, so exactly the verified contents are used.
+func (eb *EnvBuilder) verifyManifest(envFiles []EnvFile, publicKey ed25519.PublicKey) ([]EnvFile, error) {
+	manifestName := eb.Flags.Manifest
+	if manifestName == "" {
+		manifestName = defaultManifestName
+	}
+
+	manifestFile := manifestPath(eb.Flags.Dir, manifestName)
+
+	manifest, err := LoadManifest(manifestFile, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errManifestVerification, err)
+	}
+
+	envFiles = slices.DeleteFunc(envFiles, func(envFile EnvFile) bool { return isManifestFile(envFile, manifestFile) })
+	ignoreUnlisted := eb.Flags.ManifestUnlisted == "ignore"
+
+	verifiedEnvFiles, issues := manifest.Verify(envFiles, ignoreUnlisted)
+	for _, issue := range issues {
+		eb.Logger.Error("manifest verification failed", LogFields{"name": issue.Name, "reason": issue.Reason})
+	}
+
+	if len(issues) > 0 {
+		return nil, fmt.Errorf("%w: %d mismatched files", errManifestVerification, len(issues))
+	}
+
+	if ignoreUnlisted && len(verifiedEnvFiles) < len(envFiles) {
+		eb.Logger.Warn("ignoring files not listed in manifest", LogFields{"count": len(envFiles) - len(verifiedEnvFiles)})
+	}
+
+	return verifiedEnvFiles, nil
+}
+
+// decryptEnvFiles replaces `.age` files with their plaintext, named without the suffix. Identities are only loaded
+// if there is anything to decrypt.
+func (eb *EnvBuilder) decryptEnvFiles(envFiles []EnvFile) ([]EnvFile, error) {
+	var identities []age.Identity
+
+	for i, envFile := range envFiles {
+		if !strings.HasSuffix(envFile.Name, ageSuffix) {
+			continue
+		}
+
+		envName := strings.TrimSuffix(envFile.Name, ageSuffix)
+		if slices.ContainsFunc(envFiles, func(other EnvFile) bool { return other.Name == envName }) {
+			return nil, fmt.Errorf("decrypting `%s`: variable %s is also set in plain file", envFile.Path, envName)
+		}
+
+		if identities == nil {
+			var err error
+			if identities, err = eb.Flags.AgeIdentities(); err != nil {
+				return nil, fmt.Errorf("decrypting `%s`: %w", envFile.Path, err)
+			}
+		}
+
+		envData, err := decryptAge(envFile.Data, identities)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting `%s`: %w", envFile.Path, err)
+		}
+
+		envFiles[i] = EnvFile{Name: envName, Path: envFile.Path, Data: envData, Encrypted: true}
+	}
+
+	return envFiles, nil
+}
+
 func (eb *EnvBuilder) directoryEnvs() ([]string, error) {
-	envFiles, err := os.ReadDir(eb.Flags.Dir)
+	publicKey, err := eb.Flags.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errManifestVerification, err)
+	}
+
+	verify := eb.Flags.Manifest != "" || publicKey != nil
+
+	envPaths, err := listEnvFiles(eb.Flags.Dir)
+	if err != nil && verify {
+		// a directory expected to match the (signed) manifest is never skipped silently, regardless of --fail
+		return nil, fmt.Errorf("%w: %w", errManifestVerification, err)
+	}
+
 	if err != nil {
 		return eb.flagError(err)
 	}
 
+	if eb.Flags.StrictPerms == "warn" || eb.Flags.StrictPerms == "error" {
+		if err := eb.checkPerms(envPaths); err != nil {
+			return nil, err
+		}
+	}
+
+	envFiles := make([]EnvFile, 0, len(envPaths))
+
+	for _, envPath := range envPaths {
+		envFile, err := readEnvFile(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		envFiles = append(envFiles, envFile)
+	}
+
+	if verify {
+		if envFiles, err = eb.verifyManifest(envFiles, publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if envFiles, err = eb.decryptEnvFiles(envFiles); err != nil {
+		return nil, err
+	}
+
+	if envFiles, err = eb.checkExpiry(envFiles); err != nil {
+		return nil, err
+	}
+
 	dirEnvs := make([]string, 0)
+	loadedFrom := len(eb.Loaded)
 
 	for _, envFile := range envFiles {
-		envPath := filepath.Join(eb.Flags.Dir, envFile.Name())
-		envFileInfo, _ := os.Stat(envPath)
+		envValue := envFile.Value()
 
-		if envFileInfo.IsDir() {
-			continue
+		if envFile.Encrypted {
+			eb.Logger.Debug("read encrypted value from directory", LogFields{"name": envFile.Name})
+		} else {
+			eb.Logger.Debug("read value from directory", LogFields{"name": envFile.Name, "value": envValue})
+		}
+
+		if matchesAnyPattern(envFile.Name, eb.Flags.Consume) {
+			eb.consumable = append(eb.consumable, envFile)
+		}
+
+		dirEnvs = eb.appendEnv(dirEnvs, envFile.Name, envValue, envFile.Path)
+	}
+
+	return eb.filterDangerousEnvs(dirEnvs, "directory", loadedFrom)
+}
+
+// sopsEnvs decrypts variables from SOPS files, which override the directory ones.
+func (eb *EnvBuilder) sopsEnvs() ([]string, error) {
+	sopsEnvs := make([]string, 0)
+
+	if len(eb.Flags.Sops) == 0 {
+		return sopsEnvs, nil
+	}
+
+	identities, err := eb.Flags.AgeIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	loadedFrom := len(eb.Loaded)
+
+	for _, sopsPath := range eb.Flags.Sops {
+		sopsFile, err := LoadSopsFile(sopsPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading sops file `%s`: %w", sopsPath, err)
 		}
 
-		envData, err := os.ReadFile(envPath)
+		envVars, err := sopsFile.Decrypt(identities)
 		if err != nil {
-			return nil, fmt.Errorf("reading env file `%s`: %w", envPath, err)
+			return nil, fmt.Errorf("decrypting sops file `%s`: %w", sopsPath, err)
 		}
 
-		envValue := strings.TrimSuffix(string(envData), "\n")
+		for _, envVar := range envVars {
+			eb.Logger.Debug("read encrypted value from sops file", LogFields{"name": envVar.Name, "path": sopsPath})
+
+			sopsEnvs = eb.appendEnv(sopsEnvs, envVar.Name, envVar.Value, sopsPath)
+		}
+	}
+
+	if sopsEnvs, err = eb.filterDangerousEnvs(sopsEnvs, "sops", loadedFrom); err != nil {
+		return nil, err
+	}
+
+	eb.dropReplaced()
+
+	return sopsEnvs, nil
+}
 
-		eb.Logger.Debug("read value from directory", LogFields{"name": envFile.Name(), "value": envValue})
+// dropReplaced keeps only the last eb.Loaded and eb.Secrets entry of each name, as values loaded later replace
+// earlier ones, so replaced values are neither masked, audited nor passed through memfd.
+func (eb *EnvBuilder) dropReplaced() {
+	loaded := make([]LoadedEnv, 0, len(eb.Loaded))
 
-		dirEnvs = append(dirEnvs, envFile.Name()+`=`+envValue)
+	for i, loadedEnv := range eb.Loaded {
+		replaced := slices.ContainsFunc(eb.Loaded[i+1:], func(later LoadedEnv) bool { return later.Name == loadedEnv.Name })
+		if !replaced {
+			loaded = append(loaded, loadedEnv)
+		}
 	}
 
-	return dirEnvs, nil
+	secrets := make([]EnvVar, 0, len(eb.Secrets))
+
+	for i, secret := range eb.Secrets {
+		replaced := slices.ContainsFunc(eb.Secrets[i+1:], func(later EnvVar) bool { return later.Name == secret.Name })
+		if !replaced {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	eb.Loaded, eb.Secrets = loaded, secrets
+}
+
+// appendEnv appends variable to envs, unless it matches memfd patterns, and is passed to subprocess as secret instead.
+func (eb *EnvBuilder) appendEnv(envs []string, envName, envValue, source string) []string {
+	loaded := LoadedEnv{EnvVar: EnvVar{Name: envName, Value: envValue}, Source: source}
+
+	if matchesAnyPattern(envName, eb.Flags.Memfd) {
+		loaded.Memfd = true
+		eb.Loaded = append(eb.Loaded, loaded)
+		eb.Secrets = append(eb.Secrets, loaded.EnvVar)
+
+		return envs
+	}
+
+	eb.Loaded = append(eb.Loaded, loaded)
+
+	return append(envs, envName+`=`+envValue)
 }
 
 func (eb *EnvBuilder) Build() ([]string, error) {
@@ -84,7 +371,36 @@ func (eb *EnvBuilder) Build() ([]string, error) {
 		return nil, fmt.Errorf("error reading variables from directory: %w", err)
 	}
 
-	return append(eb.parentEnvs(), dirEnvs...), nil
+	sopsEnvs, err := eb.sopsEnvs()
+	if err != nil {
+		return nil, fmt.Errorf("error reading variables from sops files: %w", err)
+	}
+
+	parentEnvs := eb.parentEnvs()
+	if eb.Flags.CheckParentEnv {
+		if parentEnvs, err = eb.filterDangerousEnvs(parentEnvs, "parent", len(eb.Loaded)); err != nil {
+			return nil, fmt.Errorf("error checking variables from parent process: %w", err)
+		}
+	}
+
+	envs := make([]string, 0)
+	parentSecrets := make([]EnvVar, 0)
+
+	// variables meant to be passed through memfd never reach the command as plain variables, even from parent process
+	for _, envLine := range parentEnvs {
+		envName, envValue, _ := strings.Cut(envLine, `=`)
+		if matchesAnyPattern(envName, eb.Flags.Memfd) {
+			parentSecrets = append(parentSecrets, EnvVar{Name: envName, Value: envValue})
+		} else {
+			envs = append(envs, envLine)
+		}
+	}
+
+	// parent secrets go first, so these replaced by the directory or sops files are dropped
+	eb.Secrets = append(parentSecrets, eb.Secrets...)
+	eb.dropReplaced()
+
+	return append(append(envs, dirEnvs...), sopsEnvs...), nil
 }
 
 func NewEnvBuilder(flags *Flags, logger *Logger) *EnvBuilder {
@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -215,3 +216,139 @@ func Test_Build(t *testing.T) {
 		}
 	})
 }
+
+func Test_BuildMemfdSecrets(t *testing.T) {
+	logger := NewLogger(&Flags{}, &envOutput)
+
+	dir := t.TempDir()
+	for envName, envValue := range map[string]string{"DB_PASSWORD": "secret\n", "API_TOKEN": "token", "DB_HOST": "localhost"} {
+		if err := os.WriteFile(filepath.Join(dir, envName), []byte(envValue), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+	}
+
+	t.Setenv("API_TOKEN", "from-parent")
+	t.Setenv("OTHER_PASSWORD", "only-in-parent")
+
+	envBuilder := NewEnvBuilder(&Flags{Dir: dir, Memfd: []string{"*_PASSWORD", "API_TOKEN"}}, logger)
+
+	result, err := envBuilder.Build()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, envLine := range result {
+		if strings.HasPrefix(envLine, "DB_PASSWORD=") || strings.HasPrefix(envLine, "API_TOKEN=") || strings.HasPrefix(envLine, "OTHER_PASSWORD=") {
+			t.Errorf("expected memfd variable not to be in environment, got %q", envLine)
+		}
+	}
+
+	if !slices.Contains(result, "DB_HOST=localhost") {
+		t.Errorf("expected not matching variable to be in environment, got %v", result)
+	}
+
+	expectedSecrets := []EnvVar{{Name: "OTHER_PASSWORD", Value: "only-in-parent"}, {Name: "API_TOKEN", Value: "token"}, {Name: "DB_PASSWORD", Value: "secret"}}
+	if !slices.Equal(envBuilder.Secrets, expectedSecrets) {
+		t.Errorf("expected secrets %v, got %v", expectedSecrets, envBuilder.Secrets)
+	}
+}
+
+func Test_BuildDangerousEnvs(t *testing.T) {
+	logger := NewLogger(&Flags{}, &envOutput)
+
+	dir := t.TempDir()
+	for envName, envValue := range map[string]string{"LD_PRELOAD": "/tmp/evil.so", "NODE_OPTIONS": "--require /tmp/evil.js", "SAFE": "value"} {
+		if err := os.WriteFile(filepath.Join(dir, envName), []byte(envValue), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+	}
+
+	t.Run("it refuses dangerous variables from directory", func(t *testing.T) {
+		envBuilder := NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "error"}, logger)
+
+		_, err := envBuilder.Build()
+		if err == nil || !strings.Contains(err.Error(), "refusing dangerous variables: LD_PRELOAD, NODE_OPTIONS") {
+			t.Errorf("expected error about dangerous variables, got %v", err)
+		}
+	})
+
+	t.Run("it skips dangerous variables from directory in warn mode", func(t *testing.T) {
+		envBuilder := NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "warn", Paranoid: true}, logger)
+
+		result, err := envBuilder.Build()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if slices.Contains(result, "LD_PRELOAD=/tmp/evil.so") || !slices.Contains(result, "SAFE=value") {
+			t.Errorf("expected dangerous variables to be skipped, got %v", result)
+		}
+
+		if slices.ContainsFunc(envBuilder.Loaded, func(loaded LoadedEnv) bool { return loaded.Name == "LD_PRELOAD" }) {
+			t.Errorf("expected skipped variables not to be recorded as loaded, got %v", envBuilder.Loaded)
+		}
+	})
+
+	t.Run("it skips dangerous variables only from checked source", func(t *testing.T) {
+		envBuilder := NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "warn"}, logger)
+		envBuilder.Loaded = []LoadedEnv{{EnvVar: EnvVar{Name: "NODE_OPTIONS", Value: "--inspect"}, Source: "/other"}}
+
+		envs := envBuilder.appendEnv(nil, "NODE_OPTIONS", "--require /tmp/evil.js", "/hook")
+		if _, err := envBuilder.filterDangerousEnvs(envs, "hook", 1); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectedLoaded := []LoadedEnv{{EnvVar: EnvVar{Name: "NODE_OPTIONS", Value: "--inspect"}, Source: "/other"}}
+		if !slices.Equal(envBuilder.Loaded, expectedLoaded) {
+			t.Errorf("expected variable from other source to be kept, got %v", envBuilder.Loaded)
+		}
+	})
+
+	t.Run("it passes explicitly allowed dangerous variables", func(t *testing.T) {
+		envBuilder := NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "error", AllowDangerous: []string{"LD_*", "NODE_OPTIONS"}}, logger)
+
+		result, err := envBuilder.Build()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !slices.Contains(result, "LD_PRELOAD=/tmp/evil.so") || !slices.Contains(result, "NODE_OPTIONS=--require /tmp/evil.js") {
+			t.Errorf("expected allowed variables to be passed, got %v", result)
+		}
+	})
+
+	t.Run("it checks variables from parent process on demand", func(t *testing.T) {
+		t.Setenv("BASH_ENV", "/tmp/evil.sh")
+
+		allowDir := []string{"LD_*", "NODE_OPTIONS"}
+
+		envBuilder := NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "error", AllowDangerous: allowDir}, logger)
+		if _, err := envBuilder.Build(); err != nil {
+			t.Errorf("expected parent process not to be checked by default, got %v", err)
+		}
+
+		envBuilder = NewEnvBuilder(&Flags{Dir: dir, DangerousVars: "error", AllowDangerous: allowDir, CheckParentEnv: true}, logger)
+		if _, err := envBuilder.Build(); err == nil || !strings.Contains(err.Error(), "BASH_ENV") {
+			t.Errorf("expected error about dangerous variable from parent process, got %v", err)
+		}
+	})
+}
+
+func Test_DropReplaced(t *testing.T) {
+	envBuilder := NewEnvBuilder(&Flags{}, NewLogger(&Flags{}, &envOutput))
+	envBuilder.Loaded = []LoadedEnv{
+		{EnvVar: EnvVar{Name: "PASSWORD", Value: "old"}, Source: "/dir/PASSWORD"},
+		{EnvVar: EnvVar{Name: "HOST", Value: "localhost"}, Source: "/dir/HOST"},
+		{EnvVar: EnvVar{Name: "PASSWORD", Value: "new"}, Source: "/hooks/10-password"},
+	}
+
+	envBuilder.dropReplaced()
+
+	expectedLoaded := []LoadedEnv{
+		{EnvVar: EnvVar{Name: "HOST", Value: "localhost"}, Source: "/dir/HOST"},
+		{EnvVar: EnvVar{Name: "PASSWORD", Value: "new"}, Source: "/hooks/10-password"},
+	}
+	if !slices.Equal(envBuilder.Loaded, expectedLoaded) {
+		t.Errorf("expected only last value of each variable, got %v", envBuilder.Loaded)
+	}
+}
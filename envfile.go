@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type EnvFile struct {
+	Name string
+	Path string
+	Data []byte
+
+	// Encrypted is set for files decrypted with age, so their value is never logged.
+	Encrypted bool
+}
+
+func (ef EnvFile) Value() string {
+	return strings.TrimSuffix(string(ef.Data), "\n")
+}
+
+// resolveEnvDir returns the current data directory if dir uses the kubelet AtomicWriter layout (`..data` symlink
+// pointing to a timestamped directory), so every variable is read from the same snapshot even if `..data` is swapped
+// in the meantime. Otherwise dir is returned as is.
+func resolveEnvDir(dir string) string {
+	dataDir, err := filepath.EvalSymlinks(filepath.Join(dir, dataDirLink))
+	if err != nil {
+		return dir
+	}
+
+	return dataDir
+}
+
+func listEnvFiles(dir string) ([]string, error) {
+	dir = resolveEnvDir(dir)
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	envPaths := make([]string, 0, len(dirEntries))
+
+	for _, dirEntry := range dirEntries {
+		envPath := filepath.Join(dir, dirEntry.Name())
+
+		envFileInfo, err := os.Stat(envPath)
+		if err == nil && envFileInfo.IsDir() {
+			continue
+		}
+
+		envPaths = append(envPaths, envPath)
+	}
+
+	return envPaths, nil
+}
+
+func readEnvFile(envPath string) (EnvFile, error) {
+	envData, err := os.ReadFile(envPath)
+	if err != nil {
+		return EnvFile{}, fmt.Errorf("reading env file `%s`: %w", envPath, err)
+	}
+
+	return EnvFile{Name: filepath.Base(envPath), Path: envPath, Data: envData}, nil
+}
+
+func readEnvDir(dir string) ([]EnvFile, error) {
+	envPaths, err := listEnvFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	envFiles := make([]EnvFile, 0, len(envPaths))
+
+	for _, envPath := range envPaths {
+		envFile, err := readEnvFile(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		envFiles = append(envFiles, envFile)
+	}
+
+	return envFiles, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place, so readers never see
+// a partially written file. Symlinks are followed, so the file they point to is replaced instead of the link.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicWith(path, data, perm, nil)
+}
+
+// replaceFileAtomic rewrites existing file in place, keeping its permissions and ownership.
+func replaceFileAtomic(path string, data []byte, info os.FileInfo) error {
+	return writeFileAtomicWith(path, data, info.Mode().Perm(), func(file *os.File) error {
+		return chownLike(file, info)
+	})
+}
+
+func writeFileAtomicWith(path string, data []byte, perm os.FileMode, prepare func(*os.File) error) error {
+	if resolvedPath, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolvedPath
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file for `%s`: %w", path, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+
+		return fmt.Errorf("writing temporary file for `%s`: %w", path, err)
+	}
+
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+
+		return fmt.Errorf("setting permissions of `%s`: %w", path, err)
+	}
+
+	if prepare != nil {
+		if err := prepare(tmpFile); err != nil {
+			tmpFile.Close()
+
+			return fmt.Errorf("setting owner of `%s`: %w", path, err)
+		}
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+
+		return fmt.Errorf("syncing temporary file for `%s`: %w", path, err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("closing temporary file for `%s`: %w", path, err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("replacing `%s`: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ReadEnvDir(t *testing.T) {
+	envDir := writeEnvDir(t, map[string]string{"LOREM": "ipsum\n", "MULTILINE": "dolor\nsit\n\n"})
+
+	if err := os.MkdirAll(filepath.Join(envDir, "directory"), 0755); err != nil {
+		t.Fatalf("error creating temporary subdir: %v", err)
+	}
+
+	envFiles, err := readEnvDir(envDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(envFiles) != 2 {
+		t.Fatalf("expected only files to be read, got %v", envFiles)
+	}
+
+	for _, tt := range []struct {
+		envFile       EnvFile
+		expectedName  string
+		expectedValue string
+	}{
+		{envFiles[0], "LOREM", "ipsum"},
+		{envFiles[1], "MULTILINE", "dolor\nsit\n"},
+	} {
+		if tt.envFile.Name != tt.expectedName || tt.envFile.Value() != tt.expectedValue {
+			t.Errorf("expected %s=%q, got %s=%q", tt.expectedName, tt.expectedValue, tt.envFile.Name, tt.envFile.Value())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const expiresSuffix = ".expires"
+
+// ExpiryIssue is a variable which is stale or expired, or one which expires soon, which is not fatal.
+type ExpiryIssue struct {
+	Name    string
+	Reason  string
+	Expired bool
+}
+
+// checkEnvFilesExpiry checks modification time of every file against maxAge, and expiry time from `NAME.expires`
+// sidecar files, which are removed from returned files.
+func checkEnvFilesExpiry(envFiles []EnvFile, maxAge, window time.Duration, now time.Time) ([]EnvFile, []ExpiryIssue, error) {
+	issues := make([]ExpiryIssue, 0)
+	expiries := make(map[string]time.Time)
+
+	for _, envFile := range envFiles {
+		if !strings.HasSuffix(envFile.Name, expiresSuffix) {
+			continue
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(envFile.Data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid expiry time in `%s`, expected RFC3339 timestamp", envFile.Path)
+		}
+
+		expiries[strings.TrimSuffix(envFile.Name, expiresSuffix)] = expiresAt
+	}
+
+	envFiles = slices.DeleteFunc(envFiles, func(envFile EnvFile) bool { return strings.HasSuffix(envFile.Name, expiresSuffix) })
+
+	for _, envFile := range envFiles {
+		if maxAge > 0 {
+			fileInfo, err := os.Stat(envFile.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if age := now.Sub(fileInfo.ModTime()); age > maxAge {
+				reason := fmt.Sprintf("modified %s ago, more than max age %s", age.Round(time.Second), maxAge)
+				issues = append(issues, ExpiryIssue{envFile.Name, reason, true})
+			}
+		}
+
+		expiresAt, ok := expiries[envFile.Name]
+
+		switch {
+		case !ok:
+		case !now.Before(expiresAt):
+			issues = append(issues, ExpiryIssue{envFile.Name, "expired at " + expiresAt.Format(time.RFC3339), true})
+		case expiresAt.Sub(now) <= window:
+			issues = append(issues, ExpiryIssue{envFile.Name, "expires at " + expiresAt.Format(time.RFC3339), false})
+		}
+	}
+
+	return envFiles, issues, nil
+}
+
+// checkExpiry reports every stale, expired or soon expiring variable, and fails afterwards if there are expired ones,
+// unless only warnings are requested. Without any expiry option, `.expires` files are regular files.
+func (eb *EnvBuilder) checkExpiry(envFiles []EnvFile) ([]EnvFile, error) {
+	if eb.Flags.MaxAge == 0 && eb.Flags.ExpiryWindow == 0 && !eb.Flags.IsSet("expired") {
+		return envFiles, nil
+	}
+
+	envFiles, issues, err := checkEnvFilesExpiry(envFiles, eb.Flags.MaxAge, eb.Flags.ExpiryWindow, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("checking expiry: %w", err)
+	}
+
+	expiredCount := 0
+
+	for _, issue := range issues {
+		if !issue.Expired {
+			eb.Logger.Warn("variable expires soon", LogFields{"name": issue.Name, "reason": issue.Reason})
+
+			continue
+		}
+
+		expiredCount++
+
+		if eb.Flags.Expired == "warn" {
+			eb.Logger.Warn("expired variable", LogFields{"name": issue.Name, "reason": issue.Reason})
+		} else {
+			eb.Logger.Error("expired variable", LogFields{"name": issue.Name, "reason": issue.Reason})
+		}
+	}
+
+	if expiredCount > 0 && eb.Flags.Expired != "warn" {
+		return nil, fmt.Errorf("found %d stale or expired variables", expiredCount)
+	}
+
+	return envFiles, nil
+}
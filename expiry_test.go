@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_CheckEnvFilesExpiry(t *testing.T) {
+	dir := writeEnvDir(t, map[string]string{"FRESH": "a\n", "STALE": "b\n", "EXPIRED": "c\n", "EXPIRING": "d\n"})
+
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(dir, "STALE"), now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	envFiles, _ := readEnvDir(dir)
+	envFiles = append(envFiles,
+		EnvFile{Name: "EXPIRED.expires", Data: []byte(now.Add(-time.Minute).Format(time.RFC3339) + "\n")},
+		EnvFile{Name: "EXPIRING.expires", Data: []byte(now.Add(time.Hour).Format(time.RFC3339))},
+		EnvFile{Name: "FRESH.expires", Data: []byte(now.Add(72 * time.Hour).Format(time.RFC3339))},
+	)
+
+	checkedEnvFiles, issues, err := checkEnvFilesExpiry(slices.Clone(envFiles), 24*time.Hour, 2*time.Hour, now)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(checkedEnvFiles) != 4 {
+		t.Errorf("expected expiry files to be removed, got %v", checkedEnvFiles)
+	}
+
+	expectedIssues := map[string]bool{"EXPIRED": true, "EXPIRING": false, "STALE": true}
+	if len(issues) != len(expectedIssues) {
+		t.Fatalf("expected issues for %v, got %v", expectedIssues, issues)
+	}
+
+	for _, issue := range issues {
+		if expired, ok := expectedIssues[issue.Name]; !ok || expired != issue.Expired {
+			t.Errorf("unexpected issue %v", issue)
+		}
+	}
+
+	if _, issues, _ := checkEnvFilesExpiry(envFiles, 0, 0, now); len(issues) != 1 || issues[0].Name != "EXPIRED" {
+		t.Errorf("expected only expired variable without max age and window, got %v", issues)
+	}
+
+	invalidEnvFiles := []EnvFile{{Name: "A.expires", Path: "A.expires", Data: []byte("tomorrow")}}
+	if _, _, err := checkEnvFilesExpiry(invalidEnvFiles, 0, 0, now); err == nil || !strings.Contains(err.Error(), "A.expires") {
+		t.Errorf("expected invalid expiry time error, got %v", err)
+	}
+}
+
+func TestCmd_Expiry(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := writeEnvDir(t, map[string]string{"TOKEN": "t0k3n\n", "TOKEN.expires": "2020-01-01T00:00:00Z\n"})
+
+	t.Run("it refuses to run with expired variables", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", dir, "--expired", "error", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "expired variable") || !strings.Contains(cmdStdout.String(), "name=TOKEN") {
+			t.Errorf("expected expired variable in log, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it only warns about expired variables", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", dir, "--expired", "warn", "--max-age", "24h", "sh", "-c", `echo "$TOKEN $TOKEN_EXPIRES"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "t0k3n \n") {
+			t.Errorf("expected variable without expiry file, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it ignores expiry files without expiry options", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		invalidDir := writeEnvDir(t, map[string]string{"TOKEN": "t0k3n\n", "TOKEN.expires": "tomorrow\n"})
+
+		os.Args = []string{"envdir", "-d", invalidDir, "sh", "-c", `echo "$TOKEN"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "t0k3n\n") {
+			t.Errorf("expected variable to be passed, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it rejects invalid max age", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", dir, "--max-age", "-1h", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
@@ -3,13 +3,22 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Flags struct {
 	Help bool
+	Err  error
 
+	Config      string
 	Dir         string
 	Fail        bool
 	Paranoid    bool
@@ -17,8 +26,443 @@ type Flags struct {
 	LogLevel    string
 	ShowVersion bool
 
+	StrictPerms    string
+	DangerousVars  string
+	AllowDangerous []string
+	CheckParentEnv bool
+
+	Manifest           string
+	ManifestUnlisted   string
+	ManifestPubkey     string
+	ManifestPubkeyFile string
+
+	AgeIdentity string
+	Sops        []string
+
+	User        string
+	Limits      map[string]Rlimit
+	Chdir       string
+	Umask       *os.FileMode
+	Argv0       string
+	Nice        *int
+	OOMScoreAdj *int
+	NoNewPrivs  bool
+	DropCaps    bool
+	CapKeep     []string
+	AmbientCaps bool
+
+	FsRO           []string
+	FsRW           []string
+	DenySecretsDir bool
+	HideSecretsDir bool
+
+	Memfd    []string
+	MemfdEnv string
+
+	Consume        []string
+	ConsumeShred   bool
+	ConsumeFailure string
+
+	MaxAge       time.Duration
+	ExpiryWindow time.Duration
+	Expired      string
+
+	Mask          bool
+	MaskMinLength *int
+	MaskEncoded   bool
+
+	Audit        string
+	AuditKeyFile string
+
+	Hooks        string
+	HooksFailure string
+	HookTimeout  time.Duration
+
 	Cmd  string
 	Args []string
+
+	flagSet *flag.FlagSet
+}
+
+// ConfigOption binds a config file key, which is also the long flag name, to its ENVDIR_* variable.
+type ConfigOption struct {
+	Key string
+	Env string
+}
+
+var configOptions = []ConfigOption{
+	{"dir", "ENVDIR_DIRECTORY"},
+	{"fail", "ENVDIR_FAIL"},
+	{"paranoid", "ENVDIR_PARANOID"},
+	{"strict-perms", "ENVDIR_STRICT_PERMS"},
+	{"dangerous-vars", "ENVDIR_DANGEROUS_VARS"},
+	{"allow-dangerous", "ENVDIR_ALLOW_DANGEROUS"},
+	{"check-parent-env", "ENVDIR_CHECK_PARENT_ENV"},
+	{"manifest", "ENVDIR_MANIFEST"},
+	{"manifest-unlisted", "ENVDIR_MANIFEST_UNLISTED"},
+	{"manifest-pubkey", "ENVDIR_MANIFEST_PUBKEY"},
+	{"manifest-pubkey-file", "ENVDIR_MANIFEST_PUBKEY_FILE"},
+	{"age-identity", "ENVDIR_AGE_IDENTITY"},
+	{"sops", "ENVDIR_SOPS"},
+	{"log-format", "ENVDIR_LOG_FORMAT"},
+	{"log-level", "ENVDIR_LOG_LEVEL"},
+	{"user", "ENVDIR_USER"},
+	{"limit-nofile", "ENVDIR_LIMIT_NOFILE"},
+	{"limit-nproc", "ENVDIR_LIMIT_NPROC"},
+	{"limit-as", "ENVDIR_LIMIT_AS"},
+	{"limit-data", "ENVDIR_LIMIT_DATA"},
+	{"limit-core", "ENVDIR_LIMIT_CORE"},
+	{"limit-stack", "ENVDIR_LIMIT_STACK"},
+	{"limit-cpu", "ENVDIR_LIMIT_CPU"},
+	{"chdir", "ENVDIR_CHDIR"},
+	{"umask", "ENVDIR_UMASK"},
+	{"argv0", "ENVDIR_ARGV0"},
+	{"nice", "ENVDIR_NICE"},
+	{"oom-score-adj", "ENVDIR_OOM_SCORE_ADJ"},
+	{"no-new-privs", "ENVDIR_NO_NEW_PRIVS"},
+	{"drop-caps", "ENVDIR_DROP_CAPS"},
+	{"cap-keep", "ENVDIR_CAP_KEEP"},
+	{"ambient-caps", "ENVDIR_AMBIENT_CAPS"},
+	{"fs-ro", "ENVDIR_FS_RO"},
+	{"fs-rw", "ENVDIR_FS_RW"},
+	{"deny-secrets-dir", "ENVDIR_DENY_SECRETS_DIR"},
+	{"hide-secrets-dir", "ENVDIR_HIDE_SECRETS_DIR"},
+	{"memfd", "ENVDIR_MEMFD"},
+	{"memfd-env", "ENVDIR_MEMFD_ENV"},
+	{"consume", "ENVDIR_CONSUME"},
+	{"consume-shred", "ENVDIR_CONSUME_SHRED"},
+	{"consume-failure", "ENVDIR_CONSUME_FAILURE"},
+	{"max-age", "ENVDIR_MAX_AGE"},
+	{"expiry-window", "ENVDIR_EXPIRY_WINDOW"},
+	{"expired", "ENVDIR_EXPIRED"},
+	{"mask", "ENVDIR_MASK"},
+	{"mask-min-length", "ENVDIR_MASK_MIN_LENGTH"},
+	{"mask-encoded", "ENVDIR_MASK_ENCODED"},
+	{"audit", "ENVDIR_AUDIT"},
+	{"audit-key-file", "ENVDIR_AUDIT_KEY_FILE"},
+	{"hooks", "ENVDIR_HOOKS"},
+	{"hooks-failure", "ENVDIR_HOOKS_FAILURE"},
+	{"hook-timeout", "ENVDIR_HOOK_TIMEOUT"},
+}
+
+// shortFlags maps short flag names to long ones they are aliases of.
+var shortFlags = map[string]string{
+	"d":  "dir",
+	"f":  "fail",
+	"p":  "paranoid",
+	"u":  "user",
+	"lf": "log-format",
+	"ll": "log-level",
+	"v":  "version",
+}
+
+func longFlagName(name string) string {
+	if longName, ok := shortFlags[name]; ok {
+		return longName
+	}
+
+	return name
+}
+
+func shortFlagName(longName string) string {
+	for name, aliasedName := range shortFlags {
+		if aliasedName == longName {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// splitShebangArgs splits the first argument on whitespace, if it is an option. On Linux everything after the
+// interpreter in a shebang line is passed as a single argument, so `#!/usr/bin/envdir -d /app/env -p /bin/sh`
+// runs envdir with `-d /app/env -p /bin/sh` and the script path as its only arguments.
+func splitShebangArgs(args []string) []string {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "-") || !strings.ContainsAny(args[0], " \t") {
+		return args
+	}
+
+	return append(strings.Fields(args[0]), args[1:]...)
+}
+
+func usage(flagSet *flag.FlagSet) func() {
+	return func() {
+		output := flagSet.Output()
+		fmt.Fprintf(output, "Usage: %s [options] [--] command [args...]\n\nOptions:\n", flagSet.Name())
+
+		flagSet.VisitAll(func(option *flag.Flag) {
+			if longFlagName(option.Name) != option.Name {
+				return
+			}
+
+			names := "--" + option.Name
+			if shortName := shortFlagName(option.Name); shortName != "" {
+				names = "-" + shortName + ", " + names
+			}
+
+			if valueName, _ := flag.UnquoteUsage(option); valueName != "" {
+				names += " " + valueName
+			}
+
+			if option.DefValue != "" && option.DefValue != "false" {
+				fmt.Fprintf(output, "  %s\n    \t%s (default %q)\n", names, option.Usage, option.DefValue)
+			} else {
+				fmt.Fprintf(output, "  %s\n    \t%s\n", names, option.Usage)
+			}
+		})
+	}
+}
+
+// parseBool accepts the usual ways of spelling booleans in environment variables, case insensitive.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean value %q", value)
+	}
+}
+
+type boolValue bool
+
+func newBoolValue(target *bool, value bool) *boolValue {
+	*target = value
+
+	return (*boolValue)(target)
+}
+
+func (b *boolValue) Set(value string) error {
+	parsedValue, err := parseBool(value)
+	if err != nil {
+		return err
+	}
+
+	*b = boolValue(parsedValue)
+
+	return nil
+}
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+func (b *boolValue) Get() any {
+	return bool(*b)
+}
+
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+var (
+	logFormats = []string{"text", "json"}
+	logLevels  = []string{"error", "warn", "info", "debug"}
+)
+
+type choiceValue struct {
+	target  *string
+	choices []string
+}
+
+func newChoiceValue(target *string, value string, choices ...string) *choiceValue {
+	*target = value
+
+	return &choiceValue{target: target, choices: choices}
+}
+
+func (c *choiceValue) Set(value string) error {
+	for _, choice := range c.choices {
+		if value == choice {
+			*c.target = value
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid value %q, expected one of: %s", value, strings.Join(c.choices, ", "))
+}
+
+func (c *choiceValue) String() string {
+	if c.target == nil {
+		return ""
+	}
+
+	return *c.target
+}
+
+func (c *choiceValue) Get() any {
+	return *c.target
+}
+
+// umaskValue is an octal file mode creation mask, which is left unchanged unless set.
+type umaskValue struct {
+	target **os.FileMode
+}
+
+func (u *umaskValue) Set(value string) error {
+	mask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mask > 0777 {
+		return fmt.Errorf("invalid umask %q", value)
+	}
+
+	umask := os.FileMode(mask)
+	*u.target = &umask
+
+	return nil
+}
+
+func (u *umaskValue) String() string {
+	if u.target == nil || *u.target == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%04o", uint32(**u.target))
+}
+
+func (u *umaskValue) Get() any {
+	return u.String()
+}
+
+// intRangeValue is an integer within min and max, which is left unchanged unless set.
+type intRangeValue struct {
+	target   **int
+	min, max int
+}
+
+func (i *intRangeValue) Set(value string) error {
+	parsedValue, err := strconv.Atoi(value)
+	if err != nil || parsedValue < i.min || parsedValue > i.max {
+		return fmt.Errorf("invalid value %q, expected integer from %d to %d", value, i.min, i.max)
+	}
+
+	*i.target = &parsedValue
+
+	return nil
+}
+
+func (i *intRangeValue) String() string {
+	if i.target == nil || *i.target == nil {
+		return ""
+	}
+
+	return strconv.Itoa(**i.target)
+}
+
+func (i *intRangeValue) Get() any {
+	return i.String()
+}
+
+// durationValue is a non-negative duration, zero disables the option.
+type durationValue struct {
+	target *time.Duration
+}
+
+func (d *durationValue) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+
+	*d.target = duration
+
+	return nil
+}
+
+func (d *durationValue) String() string {
+	if d.target == nil || *d.target == 0 {
+		return ""
+	}
+
+	return d.target.String()
+}
+
+func (d *durationValue) Get() any {
+	return d.String()
+}
+
+// listValue is implemented by options collecting values from any number of flags. A list set from an ENVDIR_*
+// variable is replaced, not extended, by the first flag, so flags take precedence the same way as for other options.
+type listValue interface {
+	flag.Value
+	replaceOnSet()
+}
+
+// pathListValue collects paths from any number of flags, each of them can hold a list separated the same way as PATH.
+type pathListValue struct {
+	target  *[]string
+	replace bool
+}
+
+func (p *pathListValue) replaceOnSet() {
+	p.replace = true
+}
+
+func (p *pathListValue) Set(value string) error {
+	if p.replace {
+		*p.target, p.replace = nil, false
+	}
+
+	for _, path := range filepath.SplitList(value) {
+		if path == "" {
+			return fmt.Errorf("empty path in %q", value)
+		}
+
+		*p.target = append(*p.target, path)
+	}
+
+	return nil
+}
+
+func (p *pathListValue) String() string {
+	if p.target == nil {
+		return ""
+	}
+
+	return strings.Join(*p.target, string(filepath.ListSeparator))
+}
+
+func (p *pathListValue) Get() any {
+	return *p.target
+}
+
+// patternListValue collects comma separated variable name patterns, from any number of flags.
+type patternListValue struct {
+	target  *[]string
+	replace bool
+}
+
+func (p *patternListValue) replaceOnSet() {
+	p.replace = true
+}
+
+func (p *patternListValue) Set(value string) error {
+	if p.replace {
+		*p.target, p.replace = nil, false
+	}
+
+	for _, pattern := range strings.Split(value, ",") {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+
+		*p.target = append(*p.target, pattern)
+	}
+
+	return nil
+}
+
+func (p *patternListValue) String() string {
+	if p.target == nil {
+		return ""
+	}
+
+	return strings.Join(*p.target, ",")
+}
+
+func (p *patternListValue) Get() any {
+	return *p.target
 }
 
 func (f *Flags) Getenv(envName, envDefault string) string {
@@ -30,22 +474,155 @@ func (f *Flags) Getenv(envName, envDefault string) string {
 	return env
 }
 
+// applyEnv sets options from ENVDIR_* variables, validating them the same way as flags.
+func (f *Flags) applyEnv() error {
+	for _, option := range configOptions {
+		if value := os.Getenv(option.Env); value != "" {
+			if err := f.flagSet.Set(option.Key, value); err != nil {
+				return fmt.Errorf("invalid value of %s: %w", option.Env, err)
+			}
+
+			if list, ok := f.flagSet.Lookup(option.Key).Value.(listValue); ok {
+				list.replaceOnSet()
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyConfig sets options from config file, unless they were already set by a flag or an ENVDIR_* variable.
+func (f *Flags) applyConfig(config ConfigValues) error {
+	setFlags := make(map[string]bool)
+	f.flagSet.Visit(func(setFlag *flag.Flag) { setFlags[longFlagName(setFlag.Name)] = true })
+
+	for _, option := range configOptions {
+		values, ok := config[option.Key]
+		if !ok || setFlags[option.Key] {
+			continue
+		}
+
+		for _, value := range values {
+			// empty value means unset, like an empty ENVDIR_* variable, as written by `config print`
+			if value == "" {
+				continue
+			}
+
+			if err := f.flagSet.Set(option.Key, value); err != nil {
+				return fmt.Errorf("invalid value of `%s` in config file: %w", option.Key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsSet checks whether an option was set by a flag, an ENVDIR_* variable or config file.
+func (f *Flags) IsSet(key string) bool {
+	if f.flagSet == nil {
+		return false
+	}
+
+	isSet := false
+	f.flagSet.Visit(func(setFlag *flag.Flag) { isSet = isSet || longFlagName(setFlag.Name) == key })
+
+	return isSet
+}
+
+// ConfigValue returns effective value of a config option.
+func (f *Flags) ConfigValue(option ConfigOption) any {
+	return f.flagSet.Lookup(option.Key).Value.(flag.Getter).Get()
+}
+
 func NewFlags(outputBuffer io.Writer) *Flags {
+	return newFlagsFromArgs(splitShebangArgs(os.Args[1:]), outputBuffer)
+}
+
+func newFlagsFromArgs(args []string, outputBuffer io.Writer) *Flags {
 	flagSet := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	flagSet.SetOutput(outputBuffer)
-	flags := Flags{}
+	flagSet.Usage = usage(flagSet)
+	flags := Flags{flagSet: flagSet, Limits: make(map[string]Rlimit)}
 
-	flagSet.StringVar(&flags.Dir, "d", flags.Getenv("ENVDIR_DIRECTORY", "/secrets"), "Directory to read files from")
-	flagSet.BoolVar(&flags.Fail, "f", flags.Getenv("ENVDIR_FAIL", "false") == "true", "Fail if missing directory")
-	flagSet.BoolVar(&flags.Paranoid, "p", flags.Getenv("ENVDIR_PARANOID", "false") == "true", "Don't pass any env vars except default system ones")
-	flagSet.StringVar(&flags.LogFormat, "lf", flags.Getenv("ENVDIR_LOG_FORMAT", "text"), "Log format (text/json)")
-	flagSet.StringVar(&flags.LogLevel, "ll", flags.Getenv("ENVDIR_LOG_LEVEL", "warn"), "Log level (error/warn/info/debug)")
-	flagSet.BoolVar(&flags.ShowVersion, "v", false, "Print version info and exit")
+	flagSet.StringVar(&flags.Config, "config", flags.Getenv("ENVDIR_CONFIG", ""), "Config file (default "+defaultConfigPath+" if exists)")
+	flagSet.StringVar(&flags.Dir, "dir", "/secrets", "Directory to read files from")
+	flagSet.Var(newBoolValue(&flags.Fail, false), "fail", "Fail if missing directory")
+	flagSet.Var(newBoolValue(&flags.Paranoid, false), "paranoid", "Don't pass any env vars except default system ones")
+	flagSet.Var(newChoiceValue(&flags.StrictPerms, "off", "off", "warn", "error"), "strict-perms", "Check permissions and ownership of files (off/warn/error)")
+	flagSet.Var(newChoiceValue(&flags.DangerousVars, "warn", "error", "warn"), "dangerous-vars", "Refuse to run with, or skip dangerous variables (error/warn)")
+	flagSet.Var(&patternListValue{target: &flags.AllowDangerous}, "allow-dangerous", "Allow dangerous variables matching patterns (comma separated)")
+	flagSet.Var(newBoolValue(&flags.CheckParentEnv, false), "check-parent-env", "Check variables from parent process for dangerous ones too")
+	flagSet.StringVar(&flags.Manifest, "manifest", "", "Verify files against SHA256SUMS manifest, relative to directory (default "+defaultManifestName+" if signed)")
+	flagSet.Var(newChoiceValue(&flags.ManifestUnlisted, "reject", "reject", "ignore"), "manifest-unlisted", "Reject or ignore files not listed in manifest (reject/ignore)")
+	flagSet.Var(&publicKeyValue{target: &flags.ManifestPubkey}, "manifest-pubkey", "Verify manifest signature with Ed25519 public key (base64)")
+	flagSet.StringVar(&flags.ManifestPubkeyFile, "manifest-pubkey-file", "", "Verify manifest signature with Ed25519 public key from file")
+	flagSet.StringVar(&flags.AgeIdentity, "age-identity", "", "Decrypt .age files with age identity file")
+	flagSet.Var(&pathListValue{target: &flags.Sops}, "sops", "Read variables from SOPS encrypted dotenv, JSON or YAML files")
+	flagSet.Var(newChoiceValue(&flags.LogFormat, "text", logFormats...), "log-format", "Log format (text/json)")
+	flagSet.Var(newChoiceValue(&flags.LogLevel, "warn", logLevels...), "log-level", "Log level (error/warn/info/debug)")
+	flagSet.StringVar(&flags.User, "user", "", "Run command as user (name|uid[:group|gid])")
+	for _, name := range rlimitNames {
+		flagSet.Var(&rlimitValue{limits: flags.Limits, name: name}, "limit-"+name, "Set "+name+" resource limit of command (soft:hard, soft:, :hard or both)")
+	}
+
+	flagSet.StringVar(&flags.Chdir, "chdir", "", "Run command in directory")
+	flagSet.Var(&umaskValue{target: &flags.Umask}, "umask", "Run command with umask (octal)")
+	flagSet.StringVar(&flags.Argv0, "argv0", "", "Run command with argv[0] set to name")
+	flagSet.Var(&intRangeValue{target: &flags.Nice, min: -20, max: 19}, "nice", "Run command with nice level (-20 to 19)")
+	flagSet.Var(&intRangeValue{target: &flags.OOMScoreAdj, min: -1000, max: 1000}, "oom-score-adj", "Run command with OOM score adjustment (-1000 to 1000)")
+	flagSet.Var(newBoolValue(&flags.NoNewPrivs, false), "no-new-privs", "Prevent command from gaining privileges (setuid, file capabilities)")
+	flagSet.Var(newBoolValue(&flags.DropCaps, false), "drop-caps", "Drop all capabilities of command, except kept ones")
+	flagSet.Var(&capabilityListValue{target: &flags.CapKeep}, "cap-keep", "Keep capabilities when dropping them (comma separated, implies --drop-caps)")
+	flagSet.Var(newBoolValue(&flags.AmbientCaps, false), "ambient-caps", "Keep capabilities of command after switching user")
+	flagSet.Var(&pathListValue{target: &flags.FsRO}, "fs-ro", "Allow command to read and execute files beneath path")
+	flagSet.Var(&pathListValue{target: &flags.FsRW}, "fs-rw", "Allow command full access to files beneath path")
+	flagSet.Var(newBoolValue(&flags.DenySecretsDir, false), "deny-secrets-dir", "Deny command access to directory variables were read from")
+	flagSet.Var(newBoolValue(&flags.HideSecretsDir, false), "hide-secrets-dir", "Hide directory variables were read from with empty tmpfs")
+	flagSet.Var(&patternListValue{target: &flags.Memfd}, "memfd", "Pass variables matching patterns (comma separated) through memfd files")
+	flagSet.Var(newChoiceValue(&flags.MemfdEnv, "file", "file", "fd"), "memfd-env", "Export memfd variables as NAME_FILE paths or NAME_FD numbers (file/fd)")
+	flagSet.Var(&patternListValue{target: &flags.Consume}, "consume", "Remove files of variables matching patterns (comma separated) before running command")
+	flagSet.Var(newBoolValue(&flags.ConsumeShred, false), "consume-shred", "Overwrite consumed files with zeros before removing them")
+	flagSet.Var(newChoiceValue(&flags.ConsumeFailure, "error", "error", "warn"), "consume-failure", "Refuse to run, or only warn if consumed files cannot be removed (error/warn)")
+	flagSet.Var(&durationValue{target: &flags.MaxAge}, "max-age", "Treat files modified longer ago than duration as expired")
+	flagSet.Var(&durationValue{target: &flags.ExpiryWindow}, "expiry-window", "Warn about variables expiring within duration")
+	flagSet.Var(newChoiceValue(&flags.Expired, "error", "error", "warn"), "expired", "Refuse to run, or only warn with stale or expired variables (error/warn)")
+	flagSet.Var(newBoolValue(&flags.Mask, false), "mask", "Replace values of variables in command output with ***")
+	flagSet.Var(&intRangeValue{target: &flags.MaskMinLength, min: 1, max: math.MaxInt32}, "mask-min-length", "Mask only values at least that long (default "+strconv.Itoa(defaultMaskMinLength)+")")
+	flagSet.Var(newBoolValue(&flags.MaskEncoded, false), "mask-encoded", "Mask base64 and URL encoded values too")
+	flagSet.StringVar(&flags.Audit, "audit", "", "Append audit record of variables to file, or file descriptor number")
+	flagSet.StringVar(&flags.AuditKeyFile, "audit-key-file", "", "Key for HMAC of values in audit record")
+	flagSet.StringVar(&flags.Hooks, "hooks", "", "Run executables from directory before command")
+	flagSet.Var(newChoiceValue(&flags.HooksFailure, "error", "error", "warn"), "hooks-failure", "Refuse to run, or only warn if hook fails (error/warn)")
+	flagSet.Var(&durationValue{target: &flags.HookTimeout}, "hook-timeout", "Kill hooks running longer than duration")
+
+	flagSet.BoolVar(&flags.ShowVersion, "version", false, "Print version info and exit")
+
+	for shortName, longName := range shortFlags {
+		option := flagSet.Lookup(longName)
+		flagSet.Var(option.Value, shortName, option.Usage)
+	}
+
+	// ENVDIR_* variables are applied before parsing, so flags take precedence over them and both take precedence over
+	// the config file, which is only applied to options not set in any other way.
+	flags.Err = flags.applyEnv()
 
-	err := flagSet.Parse(os.Args[1:])
+	err := flagSet.Parse(args)
 	flags.Help = errors.Is(err, flag.ErrHelp)
 
-	args := flagSet.Args()
+	if err != nil && !flags.Help {
+		flags.Err = errors.Join(flags.Err, err)
+	}
+
+	if flags.Err == nil && !flags.Help {
+		config, err := LoadConfig(flags.Config)
+		if err == nil {
+			err = flags.applyConfig(config)
+		}
+
+		flags.Err = err
+	}
+
+	args = flagSet.Args()
 	if len(args) == 0 {
 		flags.Cmd = ""
 		flags.Args = make([]string, 0)
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -180,3 +182,201 @@ func Test_FlagsHelpFlag(t *testing.T) {
 		t.Errorf("invalid Help flag, expected true, got false")
 	}
 }
+
+func Test_FlagsBooleanValues(t *testing.T) {
+	var tests = []struct {
+		envValue      string
+		expectedValue bool
+	}{
+		{"1", true}, {"true", true}, {"TRUE", true}, {"yes", true}, {"On", true},
+		{"0", false}, {"false", false}, {"False", false}, {"no", false}, {"OFF", false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("ENVDIR_FAIL", tt.envValue)
+		t.Setenv("ENVDIR_PARANOID", tt.envValue)
+
+		flags := newFlagsFromArgs([]string{}, &flagsOutput)
+		if flags.Err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.envValue, flags.Err)
+		}
+
+		if flags.Fail != tt.expectedValue || flags.Paranoid != tt.expectedValue {
+			t.Errorf("invalid boolean value for %q: expected %t, got fail=%t paranoid=%t", tt.envValue, tt.expectedValue, flags.Fail, flags.Paranoid)
+		}
+	}
+
+	flags := newFlagsFromArgs([]string{"-f=no", "-p=yes"}, &flagsOutput)
+	if flags.Err != nil || flags.Fail || !flags.Paranoid {
+		t.Errorf("invalid boolean flags: fail=%t paranoid=%t (%v)", flags.Fail, flags.Paranoid, flags.Err)
+	}
+}
+
+func Test_FlagsMalformed(t *testing.T) {
+	var tests = []struct {
+		name          string
+		env           map[string]string
+		args          []string
+		expectedError string
+	}{
+		{"fail env", map[string]string{"ENVDIR_FAIL": "maybe"}, []string{}, `invalid value of ENVDIR_FAIL: invalid boolean value "maybe"`},
+		{"paranoid env", map[string]string{"ENVDIR_PARANOID": "2"}, []string{}, `invalid value of ENVDIR_PARANOID: invalid boolean value "2"`},
+		{"log level env", map[string]string{"ENVDIR_LOG_LEVEL": "verbose"}, []string{}, `invalid value of ENVDIR_LOG_LEVEL: invalid value "verbose"`},
+		{"log format env", map[string]string{"ENVDIR_LOG_FORMAT": "xml"}, []string{}, `invalid value of ENVDIR_LOG_FORMAT: invalid value "xml"`},
+		{"fail flag", map[string]string{}, []string{"-f=maybe"}, `invalid boolean value "maybe" for -f`},
+		{"log level flag", map[string]string{}, []string{"-ll", "DEBUG"}, `invalid value "DEBUG" for flag -ll`},
+		{"log format flag", map[string]string{}, []string{"-lf", "yaml"}, `invalid value "yaml" for flag -lf`},
+		{"unknown flag", map[string]string{}, []string{"-x"}, `flag provided but not defined: -x`},
+		{"missing flag value", map[string]string{}, []string{"-d"}, `flag needs an argument: -d`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for envName, envValue := range tt.env {
+				t.Setenv(envName, envValue)
+			}
+
+			flags := newFlagsFromArgs(tt.args, &flagsOutput)
+			if flags.Err == nil || !strings.Contains(flags.Err.Error(), tt.expectedError) {
+				t.Errorf("expected error %q, got %v", tt.expectedError, flags.Err)
+			}
+		})
+	}
+}
+
+func Test_FlagsLongOptions(t *testing.T) {
+	flags := newFlagsFromArgs(
+		[]string{"--dir", "/dir", "--fail", "--paranoid=true", "--log-format=json", "-ll=debug", "--", "-c", "ls -l"},
+		&flagsOutput,
+	)
+
+	var tests = []struct {
+		flagName      string
+		flagValue     any
+		expectedValue any
+	}{
+		{"args0", flags.Cmd, "-c"},
+		{"cmd1", flags.Args[0], "ls -l"},
+		{"dir", flags.Dir, "/dir"},
+		{"fail", flags.Fail, true},
+		{"paranoid", flags.Paranoid, true},
+		{"log-format", flags.LogFormat, "json"},
+		{"log-level", flags.LogLevel, "debug"},
+	}
+
+	for _, tt := range tests {
+		if tt.flagValue != tt.expectedValue {
+			t.Errorf("invalid value of flag %q: expected %v, got %v", tt.flagName, tt.expectedValue, tt.flagValue)
+		}
+	}
+
+	if flags.Err != nil {
+		t.Errorf("expected no error, got %v", flags.Err)
+	}
+}
+
+func Test_FlagsShebangArgs(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"/usr/bin/envdir", "-d /app/env  -p\t/bin/sh", "/app/entrypoint.sh", "first arg"}
+	flags := NewFlags(&flagsOutput)
+
+	if flags.Dir != "/app/env" || !flags.Paranoid || flags.Cmd != "/bin/sh" {
+		t.Errorf("expected shebang argument to be split, got dir=%q paranoid=%t cmd=%q", flags.Dir, flags.Paranoid, flags.Cmd)
+	}
+
+	if len(flags.Args) != 2 || flags.Args[0] != "/app/entrypoint.sh" || flags.Args[1] != "first arg" {
+		t.Errorf("expected remaining arguments to be kept intact, got %q", flags.Args)
+	}
+
+	os.Args = []string{"/usr/bin/envdir", "sh", "-c", "echo -d /dir"}
+	flags = NewFlags(&flagsOutput)
+
+	if flags.Cmd != "sh" || len(flags.Args) != 2 || flags.Args[1] != "echo -d /dir" {
+		t.Errorf("expected command arguments not to be split, got cmd=%q args=%q", flags.Cmd, flags.Args)
+	}
+}
+
+func Test_FlagsLongOptionsOverrideConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "envdir.yaml")
+	if err := os.WriteFile(configPath, []byte("dir: /from-file\n"), 0644); err != nil {
+		t.Fatalf("error creating config file: %v", err)
+	}
+
+	flags := newFlagsFromArgs([]string{"--config", configPath, "--dir", "/from-flag"}, &flagsOutput)
+	if flags.Dir != "/from-flag" {
+		t.Errorf("expected long flag to take precedence over config file, got %q", flags.Dir)
+	}
+}
+
+func Test_FlagsListsFromArgsOverrideEnv(t *testing.T) {
+	t.Setenv("ENVDIR_FS_RO", "/from-env")
+	t.Setenv("ENVDIR_MEMFD", "*_PASSWORD")
+	t.Setenv("ENVDIR_CAP_KEEP", "CAP_CHOWN")
+	t.Setenv("ENVDIR_ALLOW_DANGEROUS", "LD_PRELOAD")
+
+	flags := newFlagsFromArgs([]string{
+		"--fs-ro", "/from-flag", "--fs-ro", "/other-flag", "--memfd", "API_TOKEN", "--cap-keep", "CAP_KILL",
+	}, &flagsOutput)
+
+	if flags.Err != nil {
+		t.Fatalf("expected no error, got %v", flags.Err)
+	}
+
+	if strings.Join(flags.FsRO, ":") != "/from-flag:/other-flag" {
+		t.Errorf("expected flags to replace paths from env, got %q", flags.FsRO)
+	}
+
+	if strings.Join(flags.Memfd, ",") != "API_TOKEN" {
+		t.Errorf("expected flag to replace patterns from env, got %q", flags.Memfd)
+	}
+
+	if strings.Join(flags.CapKeep, ",") != "CAP_KILL" {
+		t.Errorf("expected flag to replace capabilities from env, got %q", flags.CapKeep)
+	}
+
+	if strings.Join(flags.AllowDangerous, ",") != "LD_PRELOAD" {
+		t.Errorf("expected patterns from env to be kept without flag, got %q", flags.AllowDangerous)
+	}
+}
+
+func Test_PathListValue(t *testing.T) {
+	var paths []string
+	value := &pathListValue{target: &paths}
+
+	for _, list := range []string{"/usr:/lib", "/tmp"} {
+		if err := value.Set(list); err != nil {
+			t.Fatalf("expected no error for %q, got %v", list, err)
+		}
+	}
+
+	if value.String() != "/usr:/lib:/tmp" {
+		t.Errorf("expected paths to be collected, got %q", value.String())
+	}
+
+	if err := value.Set("/usr::/lib"); err == nil {
+		t.Error("expected error for empty path, got none")
+	}
+}
+
+func Test_PatternListValue(t *testing.T) {
+	var patterns []string
+	value := &patternListValue{target: &patterns}
+
+	for _, list := range []string{"*_PASSWORD,API_TOKEN", "SECRET_?"} {
+		if err := value.Set(list); err != nil {
+			t.Fatalf("expected no error for %q, got %v", list, err)
+		}
+	}
+
+	if value.String() != "*_PASSWORD,API_TOKEN,SECRET_?" {
+		t.Errorf("expected patterns to be collected, got %q", value.String())
+	}
+
+	for _, list := range []string{"[", "A,,B"} {
+		if err := value.Set(list); err == nil {
+			t.Errorf("expected error for %q, got none", list)
+		}
+	}
+}
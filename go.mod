@@ -1,3 +1,15 @@
 module github.com/ajgon/envdir
 
 go 1.21.0
+
+require (
+	golang.org/x/term v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	filippo.io/age v1.2.1
+	golang.org/x/sys v0.21.0
+)
+
+require golang.org/x/crypto v0.24.0 // indirect
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const hookEnvFileEnv = "ENVDIR_HOOK_ENV"
+
+// hookOutputWriter logs every line written by a hook, stdout with info level and stderr with warn level.
+type hookOutputWriter struct {
+	logger *Logger
+	hook   string
+	stream string
+	buffer []byte
+}
+
+func (w *hookOutputWriter) log(line string) {
+	fields := LogFields{"hook": w.hook, "line": line}
+
+	if w.stream == "stderr" {
+		w.logger.Warn("hook output", fields)
+	} else {
+		w.logger.Info("hook output", fields)
+	}
+}
+
+func (w *hookOutputWriter) Write(data []byte) (int, error) {
+	w.buffer = append(w.buffer, data...)
+
+	for {
+		lineEnd := bytes.IndexByte(w.buffer, '\n')
+		if lineEnd < 0 {
+			break
+		}
+
+		w.log(string(w.buffer[:lineEnd]))
+		w.buffer = w.buffer[lineEnd+1:]
+	}
+
+	return len(data), nil
+}
+
+func (w *hookOutputWriter) Flush() {
+	if len(w.buffer) > 0 {
+		w.log(string(w.buffer))
+		w.buffer = nil
+	}
+}
+
+// listHooks returns executables from the directory in lexical order. Missing directory means there are no hooks.
+func (eb *EnvBuilder) listHooks() ([]string, error) {
+	dirEntries, err := os.ReadDir(eb.Flags.Hooks)
+	if errors.Is(err, os.ErrNotExist) {
+		eb.Logger.Debug("hooks directory does not exist", LogFields{"dir": eb.Flags.Hooks})
+
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	hookPaths := make([]string, 0, len(dirEntries))
+
+	for _, dirEntry := range dirEntries {
+		hookPath := filepath.Join(eb.Flags.Hooks, dirEntry.Name())
+
+		fileInfo, err := os.Stat(hookPath)
+		if err != nil || fileInfo.IsDir() {
+			continue
+		}
+
+		if fileInfo.Mode().Perm()&0111 == 0 {
+			eb.Logger.Debug("skipping non-executable hook", LogFields{"hook": hookPath})
+
+			continue
+		}
+
+		hookPaths = append(hookPaths, hookPath)
+	}
+
+	return hookPaths, nil
+}
+
+// runHook runs a single hook, and returns variables it wrote to the file passed in ENVDIR_HOOK_ENV.
+func (eb *EnvBuilder) runHook(hookPath string, envs []string) ([]EnvVar, error) {
+	hookEnvFile, err := os.CreateTemp("", "envdir-hook-*.env")
+	if err != nil {
+		return nil, fmt.Errorf("creating hook env file: %w", err)
+	}
+
+	_ = hookEnvFile.Close()
+	defer os.Remove(hookEnvFile.Name())
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if eb.Flags.HookTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, eb.Flags.HookTimeout)
+	}
+	defer cancel()
+
+	stdout := &hookOutputWriter{logger: eb.Logger, hook: hookPath, stream: "stdout"}
+	stderr := &hookOutputWriter{logger: eb.Logger, hook: hookPath, stream: "stderr"}
+
+	cmd := exec.CommandContext(ctx, hookPath)
+	cmd.Env = append(slices.Clone(envs), hookEnvFileEnv+`=`+hookEnvFile.Name())
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// processes started by the hook in background could keep output open forever
+	cmd.WaitDelay = time.Second
+
+	eb.Logger.Info("running hook", LogFields{"hook": hookPath})
+
+	err = cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", eb.Flags.HookTimeout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	hookEnvData, err := os.ReadFile(hookEnvFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("reading hook env file: %w", err)
+	}
+
+	envVars, err := parseDotenv(bytes.NewReader(hookEnvData))
+	if err != nil {
+		return nil, fmt.Errorf("parsing hook env file: %w", err)
+	}
+
+	return envVars, nil
+}
+
+// RunHooks runs executables from hooks directory in lexical order, each with the environment built so far, extended
+// by variables written by previous hooks. A failed hook stops the command from running, unless only warnings are
+// requested.
+func (eb *EnvBuilder) RunHooks(envs []string) ([]string, error) {
+	hookPaths, err := eb.listHooks()
+	if err != nil {
+		return nil, fmt.Errorf("listing hooks: %w", err)
+	}
+
+	for _, hookPath := range hookPaths {
+		envVars, err := eb.runHook(hookPath, envs)
+		if err != nil && eb.Flags.HooksFailure == "warn" {
+			eb.Logger.Warn("hook failed", LogFields{"hook": hookPath, "err": err.Error()})
+
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("hook `%s`: %w", hookPath, err)
+		}
+
+		hookEnvs := make([]string, 0, len(envVars))
+		loadedFrom := len(eb.Loaded)
+
+		for _, envVar := range envVars {
+			eb.Logger.Debug("read value from hook", LogFields{"name": envVar.Name, "hook": hookPath})
+
+			hookEnvs = eb.appendEnv(hookEnvs, envVar.Name, envVar.Value, hookPath)
+		}
+
+		if hookEnvs, err = eb.filterDangerousEnvs(hookEnvs, "hook", loadedFrom); err != nil {
+			return nil, fmt.Errorf("hook `%s`: %w", hookPath, err)
+		}
+
+		// variables set by hook replace existing ones, also when they are passed through memfd instead, but skipped
+		// dangerous ones leave them in place
+		hookNames := make([]string, 0, len(eb.Loaded)-loadedFrom)
+		for _, loaded := range eb.Loaded[loadedFrom:] {
+			hookNames = append(hookNames, loaded.Name)
+		}
+
+		eb.dropReplaced()
+
+		envs = slices.DeleteFunc(envs, func(envLine string) bool {
+			envName, _, _ := strings.Cut(envLine, `=`)
+
+			return slices.Contains(hookNames, envName)
+		})
+		envs = append(envs, hookEnvs...)
+	}
+
+	return envs, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeHooks(t *testing.T, hooks map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, script := range hooks {
+		mode := os.FileMode(0700)
+		if strings.HasSuffix(name, ".txt") {
+			mode = 0600
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), mode); err != nil {
+			t.Fatalf("error writing hook: %v", err)
+		}
+	}
+
+	return dir
+}
+
+func TestCmd_Hooks(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := writeEnvDir(t, map[string]string{"HOST": "localhost\n"})
+
+	t.Run("it runs hooks in order before command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		hooksDir := writeHooks(t, map[string]string{
+			"10-url":        `echo "URL=http://$HOST:$PORT" >> "$ENVDIR_HOOK_ENV"; echo "url set"`,
+			"05-port":       `echo "PORT=8080" >> "$ENVDIR_HOOK_ENV"; echo "HOST=example.com" >> "$ENVDIR_HOOK_ENV"`,
+			"20-warn":       `echo "something odd" >&2`,
+			"30-ignore.txt": `echo "IGNORED=1" >> "$ENVDIR_HOOK_ENV"`,
+		})
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "info", "--hooks", hooksDir, "sh", "-c", `echo "$URL $HOST $IGNORED $ENVDIR_HOOK_ENV"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "http://example.com:8080 example.com  \n") {
+			t.Errorf("expected variables from hooks, got:\n%s", cmdStdout.String())
+		}
+
+		for _, expectedLog := range []string{`msg="hook output"`, `line="url set"`, `level=WARN msg="hook output"`, `line="something odd"`} {
+			if !strings.Contains(cmdStdout.String(), expectedLog) {
+				t.Errorf("expected %q in log, got:\n%s", expectedLog, cmdStdout.String())
+			}
+		}
+	})
+
+	t.Run("it refuses to run if hook fails", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		hooksDir := writeHooks(t, map[string]string{"10-fail": "exit 3", "20-next": "echo next"})
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "info", "--hooks", hooksDir, "echo", "command"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if strings.Contains(cmdStdout.String(), "next") || strings.Contains(cmdStdout.String(), "command") {
+			t.Errorf("expected nothing to run after failed hook, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it continues after failed hook in warn mode", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		hooksDir := writeHooks(t, map[string]string{"10-fail": "exit 3", "20-next": "echo next"})
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "info", "--hooks", hooksDir, "--hooks-failure", "warn", "echo", "command"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		for _, expectedLog := range []string{`msg="hook failed"`, `line=next`, "command\n"} {
+			if !strings.Contains(cmdStdout.String(), expectedLog) {
+				t.Errorf("expected %q in output, got:\n%s", expectedLog, cmdStdout.String())
+			}
+		}
+	})
+
+	t.Run("it kills hook after timeout", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		hooksDir := writeHooks(t, map[string]string{"10-sleep": "sleep 10"})
+
+		os.Args = []string{"envdir", "-d", dir, "--hooks", hooksDir, "--hook-timeout", "100ms", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "timed out after 100ms") {
+			t.Errorf("expected timeout in log, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it masks only values not replaced by hooks", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		passwordDir := writeEnvDir(t, map[string]string{"PASSWORD": "oldsecret1\n"})
+
+		hooksDir := writeHooks(t, map[string]string{"10-password": `echo "PASSWORD=newsecret1" >> "$ENVDIR_HOOK_ENV"`})
+
+		os.Args = []string{"envdir", "-d", passwordDir, "--hooks", hooksDir, "--mask", "sh", "-c", `echo "oldsecret1 $PASSWORD"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "oldsecret1 ***\n" {
+			t.Errorf("expected only value from hook to be masked, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses dangerous variables from hooks", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		hooksDir := writeHooks(t, map[string]string{"10-preload": `echo "LD_PRELOAD=/tmp/evil.so" >> "$ENVDIR_HOOK_ENV"`})
+
+		os.Args = []string{"envdir", "-d", dir, "--hooks", hooksDir, "--dangerous-vars", "error", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+}
+
+func Test_RunHooksReplace(t *testing.T) {
+	hooksDir := writeHooks(t, map[string]string{
+		"10-replace": `printf "PASSWORD=new\nHOST=example.com\nLD_PRELOAD=/tmp/evil.so\n" >> "$ENVDIR_HOOK_ENV"`,
+	})
+
+	envBuilder := NewEnvBuilder(&Flags{Hooks: hooksDir, Memfd: []string{"PASSWORD"}, DangerousVars: "warn"}, NewLogger(&Flags{}, &envOutput))
+	envs := envBuilder.appendEnv([]string{"LD_PRELOAD=/usr/lib/libjemalloc.so"}, "PASSWORD", "old", "/dir/PASSWORD")
+	envs = envBuilder.appendEnv(envs, "HOST", "localhost", "/dir/HOST")
+
+	envs, err := envBuilder.RunHooks(envs)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedEnvs := []string{"LD_PRELOAD=/usr/lib/libjemalloc.so", "HOST=example.com"}
+	if !slices.Equal(envs, expectedEnvs) {
+		t.Errorf("expected variables replaced by hook, except skipped ones, got %v", envs)
+	}
+
+	if expectedSecrets := []EnvVar{{"PASSWORD", "new"}}; !slices.Equal(envBuilder.Secrets, expectedSecrets) {
+		t.Errorf("expected secret replaced by hook, got %v", envBuilder.Secrets)
+	}
+
+	expectedLoaded := []LoadedEnv{
+		{EnvVar: EnvVar{Name: "PASSWORD", Value: "new"}, Source: filepath.Join(hooksDir, "10-replace"), Memfd: true},
+		{EnvVar: EnvVar{Name: "HOST", Value: "example.com"}, Source: filepath.Join(hooksDir, "10-replace")},
+	}
+	if !slices.Equal(envBuilder.Loaded, expectedLoaded) {
+		t.Errorf("expected only values from hook to be loaded, got %v", envBuilder.Loaded)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// landlockAccessFSIoctlDev is handled since Landlock ABI 5, and is missing from x/sys.
+const landlockAccessFSIoctlDev = 0x8000
+
+const landlockReadAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+// landlockFileAccess lists rights which can be granted on files, all the others apply to directories only.
+const landlockFileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | landlockAccessFSIoctlDev
+
+type landlockRule struct {
+	path   string
+	access uint64
+}
+
+// landlockABI returns Landlock ABI version supported by kernel, or 0 if Landlock is not available.
+func landlockABI() int {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+
+	return int(abi)
+}
+
+// landlockHandledAccess returns all filesystem rights known to the given ABI, which are denied unless granted.
+func landlockHandledAccess(abi int) uint64 {
+	access := uint64(unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1)
+
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	if abi >= 5 {
+		access |= landlockAccessFSIoctlDev
+	}
+
+	return access
+}
+
+func isPathBeneath(path, parent string) bool {
+	return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, "/")+"/")
+}
+
+// landlockRulesAround grants access to everything beneath root except excluded path. Landlock rules can only add
+// access, so instead of root itself, every sibling of each directory on the way from root to excluded path is added.
+func landlockRulesAround(root, excluded string, access uint64) ([]landlockRule, error) {
+	var rules []landlockRule
+
+	for dir := root; dir != excluded; {
+		relativePath, err := filepath.Rel(dir, excluded)
+		if err != nil {
+			return nil, err
+		}
+
+		next := filepath.Join(dir, strings.SplitN(relativePath, string(filepath.Separator), 2)[0])
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			// symlinks are followed on lookup, so they are accessible only if their targets are
+			if path := filepath.Join(dir, entry.Name()); path != next && entry.Type()&os.ModeSymlink == 0 {
+				rules = append(rules, landlockRule{path: path, access: access})
+			}
+		}
+
+		dir = next
+	}
+
+	return rules, nil
+}
+
+// landlockRules builds rules from --fs-ro and --fs-rw paths. With --deny-secrets-dir, paths containing the secrets
+// directory are split around it, and everything else is allowed if no paths were given.
+func landlockRules(flags *Flags, handledAccess uint64) ([]landlockRule, error) {
+	var rules []landlockRule
+
+	for _, path := range flags.FsRO {
+		rules = append(rules, landlockRule{path: path, access: landlockReadAccess})
+	}
+
+	for _, path := range flags.FsRW {
+		rules = append(rules, landlockRule{path: path, access: handledAccess})
+	}
+
+	if !flags.DenySecretsDir {
+		return rules, nil
+	}
+
+	if len(rules) == 0 {
+		rules = append(rules, landlockRule{path: "/", access: handledAccess})
+	}
+
+	secretsDir, err := filepath.EvalSymlinks(flags.Dir)
+	if err != nil {
+		// there is nothing to deny, if directory does not exist
+		return rules, nil
+	}
+
+	deniedRules := make([]landlockRule, 0, len(rules))
+
+	for _, rule := range rules {
+		path, err := filepath.EvalSymlinks(rule.path)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", rule.path, err)
+		}
+
+		if isPathBeneath(path, secretsDir) {
+			return nil, fmt.Errorf("%s is inside denied secrets directory %s", rule.path, flags.Dir)
+		}
+
+		if !isPathBeneath(secretsDir, path) {
+			deniedRules = append(deniedRules, rule)
+
+			continue
+		}
+
+		splitRules, err := landlockRulesAround(path, secretsDir, rule.access)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", path, err)
+		}
+
+		deniedRules = append(deniedRules, splitRules...)
+	}
+
+	return deniedRules, nil
+}
+
+func addLandlockRule(rulesetFd int, rule landlockRule, handledAccess uint64) error {
+	fd, err := unix.Open(rule.path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", rule.path, err)
+	}
+	defer unix.Close(fd)
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("reading %s: %w", rule.path, err)
+	}
+
+	access := rule.access & handledAccess
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileAccess
+	}
+
+	pathBeneath := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+
+	_, _, errno := unix.Syscall6(
+		unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFd), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&pathBeneath)), 0, 0, 0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("adding rule for %s: %w", rule.path, errno)
+	}
+
+	return nil
+}
+
+// setupLandlock restricts filesystem access of the forking thread, which is inherited by the subprocess. Kernels
+// without Landlock run the subprocess unrestricted, with a warning.
+func setupLandlock(setup *ProcessSetup, flags *Flags, logger *Logger) error {
+	abi := landlockABI()
+	if abi == 0 {
+		logger.Warn("landlock is not supported by kernel, running command without filesystem sandbox", LogFields{})
+
+		return nil
+	}
+
+	handledAccess := landlockHandledAccess(abi)
+
+	rules, err := landlockRules(flags, handledAccess)
+	if err != nil {
+		return err
+	}
+
+	// resource limits are set by envdir re-executed in the sandbox, right before it executes the command
+	if len(flags.Limits) > 0 {
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("resolving envdir executable: %w", err)
+		}
+
+		rules = append(rules, landlockRule{path: executable, access: landlockReadAccess})
+	}
+
+	rulesetAttr := unix.LandlockRulesetAttr{Access_fs: handledAccess}
+
+	rulesetFd, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&rulesetAttr)), unsafe.Sizeof(rulesetAttr), 0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("creating landlock ruleset: %w", errno)
+	}
+
+	for _, rule := range rules {
+		if err := addLandlockRule(int(rulesetFd), rule, handledAccess); err != nil {
+			unix.Close(int(rulesetFd))
+
+			return err
+		}
+	}
+
+	logger.Info("applying landlock ruleset", LogFields{"abi": abi, "rules": len(rules)})
+
+	setup.OnThread(func() error {
+		defer unix.Close(int(rulesetFd))
+
+		// unprivileged threads can be restricted only once they cannot gain privileges back
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("setting no_new_privs: %w", err)
+		}
+
+		if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, rulesetFd, 0, 0); errno != 0 {
+			return fmt.Errorf("enforcing landlock ruleset: %w", errno)
+		}
+
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmd_Landlock(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	requireLandlock := func(t *testing.T) {
+		t.Helper()
+
+		if landlockABI() == 0 {
+			t.Skip("landlock is not supported by kernel")
+		}
+	}
+
+	createSecretsDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "TOKEN"), []byte("secret\n"), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+
+		return dir
+	}
+
+	t.Run("it denies access to secrets directory", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		requireLandlock(t)
+
+		dir := createSecretsDir(t)
+		workDir := t.TempDir()
+		script := `echo "$TOKEN"; cat "$1" || echo denied; echo allowed > "$2/file" && cat "$2/file"`
+
+		os.Args = []string{"envdir", "-d", dir, "--deny-secrets-dir", "sh", "-c", script, "sh", filepath.Join(dir, "TOKEN"), workDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "secret\ndenied\nallowed\n" {
+			t.Errorf("expected secrets directory to be denied, and everything else allowed, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it allows access to given paths only", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		requireLandlock(t)
+
+		dir := createSecretsDir(t)
+		workDir := t.TempDir()
+		script := `cat "$1"; echo denied > "$1" || echo denied; echo allowed > "$2/file" && cat "$2/file"`
+
+		os.Args = []string{"envdir", "-d", dir, "--fs-ro", "/", "--fs-rw", workDir, "sh", "-c", script, "sh", filepath.Join(dir, "TOKEN"), workDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "secret\ndenied\nallowed\n" {
+			t.Errorf("expected read only and read write paths to be applied, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses to allow paths inside denied secrets directory", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		requireLandlock(t)
+
+		dir := createSecretsDir(t)
+
+		os.Args = []string{"envdir", "-d", dir, "--fs-ro", dir, "--deny-secrets-dir", "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStdout.String(), "is inside denied secrets directory") {
+			t.Errorf("expected error about denied secrets directory, got:\n%s", cmdStdout.String())
+		}
+	})
+}
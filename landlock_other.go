@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func setupLandlock(_ *ProcessSetup, _ *Flags, _ *Logger) error {
+	return errProcessSetupNotSupported
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+)
+
+var (
+	utf8BOM         = []byte{0xEF, 0xBB, 0xBF}
+	editorFileRegex = regexp.MustCompile(`^(\..+\.sw[a-p]|.+~|#.+#|\.#.+)$`)
+)
+
+type LintIssue struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Fixable  bool   `json:"fixable"`
+	Fixed    bool   `json:"fixed"`
+}
+
+func (li LintIssue) Text() string {
+	text := fmt.Sprintf("%s: %s: %s [%s]", li.Path, li.Severity, li.Message, li.Code)
+	if li.Fixed {
+		text += " (fixed)"
+	}
+
+	return text + "\n"
+}
+
+// lintEnvFile checks a single env file for common mistakes. It returns found issues and the file contents with all
+// fixable issues corrected.
+func lintEnvFile(envFile EnvFile) ([]LintIssue, []byte) {
+	issues := make([]LintIssue, 0)
+	addIssue := func(code, severity, message string, fixable bool) {
+		issues = append(issues, LintIssue{
+			Path: envFile.Path, Name: envFile.Name, Code: code, Severity: severity, Message: message, Fixable: fixable,
+		})
+	}
+
+	if editorFileRegex.MatchString(envFile.Name) {
+		addIssue("editor-file", LintSeverityError, "editor swap or backup file would be exported as a variable", false)
+
+		return issues, envFile.Data
+	}
+
+	fixedData := envFile.Data
+
+	if bytes.HasPrefix(fixedData, utf8BOM) {
+		addIssue("bom", LintSeverityError, "file starts with UTF-8 byte order mark", true)
+		fixedData = bytes.TrimPrefix(fixedData, utf8BOM)
+	}
+
+	if bytes.Contains(fixedData, []byte("\r\n")) {
+		addIssue("crlf", LintSeverityError, "file has CRLF line endings", true)
+		fixedData = bytes.ReplaceAll(fixedData, []byte("\r\n"), []byte("\n"))
+	}
+
+	if bytes.HasSuffix(fixedData, []byte("\n\n")) {
+		addIssue("trailing-newlines", LintSeverityWarning, "file ends with more than one newline", true)
+		fixedData = append(bytes.Clone(bytes.TrimRight(fixedData, "\n")), '\n')
+	}
+
+	value, hasNewline := bytes.CutSuffix(fixedData, []byte("\n"))
+	if trimmedValue := bytes.TrimRight(value, " \t"); len(trimmedValue) != len(value) {
+		addIssue("trailing-whitespace", LintSeverityWarning, "value ends with whitespace", true)
+		fixedData = bytes.Clone(trimmedValue)
+
+		if hasNewline {
+			fixedData = append(fixedData, '\n')
+		}
+	}
+
+	return issues, fixedData
+}
+
+// Lint scans an env directory for common secret-file mistakes and optionally fixes them in place. It returns 1
+// if any error-level issue remains unfixed.
+func (c Cmd) Lint(args []string) int {
+	var (
+		outputFormat string
+		fix          bool
+	)
+
+	flagSet := c.newSubcommandFlagSet("lint")
+	flagSet.StringVar(&outputFormat, "o", "text", "Output format (text/json)")
+	flagSet.BoolVar(&fix, "fix", false, "Rewrite files atomically to fix fixable issues")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if outputFormat != "text" && outputFormat != "json" {
+		logger.Error("invalid output format", LogFields{"format": outputFormat})
+
+		return 2
+	}
+
+	if flagSet.NArg() != 1 {
+		logger.Error("lint requires exactly one directory", LogFields{"args": flagSet.Args()})
+
+		return 2
+	}
+
+	envFiles, err := readEnvDir(flagSet.Arg(0))
+	if err != nil {
+		logger.Error("error reading variables from directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	issues := make([]LintIssue, 0)
+	failed := false
+
+	for _, envFile := range envFiles {
+		fileIssues, fixedData := lintEnvFile(envFile)
+
+		if fix && !bytes.Equal(fixedData, envFile.Data) {
+			if err := fixEnvFile(flagSet.Arg(0), envFile, fixedData, logger); err != nil {
+				logger.Error("error fixing env file", LogFields{"path": envFile.Path, "err": err.Error()})
+			} else {
+				for i := range fileIssues {
+					fileIssues[i].Fixed = fileIssues[i].Fixable
+				}
+			}
+		}
+
+		for _, issue := range fileIssues {
+			failed = failed || (issue.Severity == LintSeverityError && !issue.Fixed)
+		}
+
+		issues = append(issues, fileIssues...)
+	}
+
+	if outputFormat == "json" {
+		_ = json.NewEncoder(c.Stdout).Encode(issues)
+	} else {
+		for _, issue := range issues {
+			_, _ = c.Stdout.Write([]byte(issue.Text()))
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+func fixEnvFile(dir string, envFile EnvFile, data []byte, logger *Logger) error {
+	envFileInfo, err := os.Stat(envFile.Path)
+	if err != nil {
+		return err
+	}
+
+	// files of a published directory are read through `..data`, so a new snapshot has to be published instead
+	if isDataDirLayout(dir) {
+		return updateDataDir(dir, []dataFile{{Name: envFile.Name, Data: data, Mode: envFileInfo.Mode().Perm()}}, nil, logger)
+	}
+
+	return replaceFileAtomic(envFile.Path, data, envFileInfo)
+}
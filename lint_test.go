@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_LintEnvFile(t *testing.T) {
+	var tests = []struct {
+		name          string
+		data          string
+		expectedCodes []string
+		expectedData  string
+	}{
+		{"CLEAN", "value\n", []string{}, "value\n"},
+		{"CRLF", "line1\r\nline2\r\n", []string{"crlf"}, "line1\nline2\n"},
+		{"BOM", "\xEF\xBB\xBFvalue", []string{"bom"}, "value"},
+		{"WHITESPACE", "value \t\n", []string{"trailing-whitespace"}, "value\n"},
+		{"NEWLINES", "value\n\n", []string{"trailing-newlines"}, "value\n"},
+		{"EVERYTHING", "\xEF\xBB\xBFvalue \r\n\r\n", []string{"bom", "crlf", "trailing-newlines", "trailing-whitespace"}, "value\n"},
+		{".LOREM.swp", "value", []string{"editor-file"}, "value"},
+		{"LOREM~", "value", []string{"editor-file"}, "value"},
+	}
+
+	for _, tt := range tests {
+		issues, fixedData := lintEnvFile(EnvFile{Name: tt.name, Path: tt.name, Data: []byte(tt.data)})
+
+		codes := make([]string, 0)
+		for _, issue := range issues {
+			codes = append(codes, issue.Code)
+		}
+
+		if strings.Join(codes, ",") != strings.Join(tt.expectedCodes, ",") {
+			t.Errorf("invalid issues for %s: expected %v, got %v", tt.name, tt.expectedCodes, codes)
+		}
+
+		if string(fixedData) != tt.expectedData {
+			t.Errorf("invalid fixed data for %s: expected %q, got %q", tt.name, tt.expectedData, fixedData)
+		}
+	}
+}
+
+func TestCmd_Lint(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it reports issues as json and fails", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := writeEnvDir(t, map[string]string{"CRLF": "value\r\n", "WHITESPACE": "value \n", "CLEAN": "value"})
+		os.Args = []string{"envdir", "@lint", "-o", "json", envDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected lint failure exit code, got %d", exitCode)
+		}
+
+		var issues []LintIssue
+		if err := json.Unmarshal(cmdStdout.Bytes(), &issues); err != nil {
+			t.Fatalf("expected json output, got error %v:\n%s", err, cmdStdout.String())
+		}
+
+		if len(issues) != 2 || issues[0].Name != "CRLF" || issues[0].Severity != LintSeverityError ||
+			issues[1].Name != "WHITESPACE" || issues[1].Severity != LintSeverityWarning {
+			t.Errorf("unexpected issues: %+v", issues)
+		}
+	})
+
+	t.Run("it succeeds with warnings only", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := writeEnvDir(t, map[string]string{"NEWLINES": "value\n\n"})
+		os.Args = []string{"envdir", "@lint", envDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d", exitCode)
+		}
+
+		expectedOutput := filepath.Join(envDir, "NEWLINES") + ": warning: file ends with more than one newline [trailing-newlines]\n"
+		if cmdStdout.String() != expectedOutput {
+			t.Errorf("unexpected lint output:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fixes files in place", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := writeEnvDir(t, map[string]string{"CRLF": "value\r\n", ".CRLF.swp": "junk"})
+		envPath := filepath.Join(envDir, "CRLF")
+		if err := os.Chmod(envPath, 0600); err != nil {
+			t.Fatalf("error setting permissions to test file: %v", err)
+		}
+
+		os.Args = []string{"envdir", "@lint", "-fix", envDir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected failure exit code because of unfixable issue, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStdout.String(), "file has CRLF line endings [crlf] (fixed)") {
+			t.Errorf("expected fixed issue in output:\n%s", cmdStdout.String())
+		}
+
+		envData, err := os.ReadFile(envPath)
+		if err != nil || string(envData) != "value\n" {
+			t.Errorf("expected file to be fixed, got %q (%v)", envData, err)
+		}
+
+		if envFileInfo, err := os.Stat(envPath); err != nil || envFileInfo.Mode().Perm() != 0600 {
+			t.Errorf("expected file permissions to be kept, got %v (%v)", envFileInfo.Mode(), err)
+		}
+
+		if envFiles, _ := os.ReadDir(envDir); len(envFiles) != 2 {
+			t.Errorf("expected no temporary files to be left, got %v", envFiles)
+		}
+	})
+
+	t.Run("it fails on invalid arguments", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		for _, args := range [][]string{{"envdir", "@lint"}, {"envdir", "@lint", "-o", "yaml", "/tmp"}} {
+			os.Args = args
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 2 {
+				t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+			}
+		}
+	})
+}
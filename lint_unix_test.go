@@ -0,0 +1,44 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCmd_LintFixOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file owner requires root")
+	}
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+	envDir := writeEnvDir(t, map[string]string{"CRLF": "value\r\n"})
+	envPath := filepath.Join(envDir, "CRLF")
+	if err := os.Chown(envPath, 65534, 65534); err != nil {
+		t.Fatalf("error changing owner of test file: %v", err)
+	}
+
+	os.Args = []string{"envdir", "@lint", "-fix", envDir}
+
+	cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+	if exitCode := cmd.Execute(); exitCode != 0 {
+		t.Errorf("expected success exit code, got %d, output:\n%s", exitCode, cmdStdout.String())
+	}
+
+	envFileInfo, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatalf("error reading fixed file: %v", err)
+	}
+
+	if stat := envFileInfo.Sys().(*syscall.Stat_t); stat.Uid != 65534 || stat.Gid != 65534 {
+		t.Errorf("expected file owner to be kept, got %d:%d", stat.Uid, stat.Gid)
+	}
+}
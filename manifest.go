@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// errManifestVerification is returned when env files do not match the manifest, so it can be reported with its own
+// exit code.
+var errManifestVerification = errors.New("manifest verification failed")
+
+// Manifest maps env file names to hex encoded SHA256 digests of their contents, as listed in SHA256SUMS file.
+type Manifest map[string]string
+
+// ManifestIssue is an env file which does not match the manifest.
+type ManifestIssue struct {
+	Name   string
+	Reason string
+}
+
+// manifestPath resolves manifest path relative to the directory, so it is read from the same ..data snapshot as
+// env files are.
+func manifestPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(resolveEnvDir(dir), path)
+}
+
+// parseManifest parses `sha256sum` output, in both text (`DIGEST  NAME`) and binary (`DIGEST *NAME`) modes.
+func parseManifest(data []byte) (Manifest, error) {
+	manifest := make(Manifest)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		digest, name, ok := strings.Cut(line, " ")
+		if !ok || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("invalid manifest line %d", lineNumber)
+		}
+
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid digest in manifest line %d", lineNumber)
+		}
+
+		manifest[name[1:]] = strings.ToLower(digest)
+	}
+
+	return manifest, scanner.Err()
+}
+
+// LoadManifest reads manifest, verifying its signature first, if public key is given.
+func LoadManifest(path string, publicKey ed25519.PublicKey) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	if publicKey != nil {
+		if err := verifySignature(publicKey, data, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseManifest(data)
+}
+
+// isManifestFile checks whether env file is the manifest, or its signature, which are not variables.
+func isManifestFile(envFile EnvFile, path string) bool {
+	return envFile.Path == path || envFile.Path == path+signatureSuffix
+}
+
+func generateManifest(envFiles []EnvFile) []byte {
+	sortedEnvFiles := append([]EnvFile(nil), envFiles...)
+	sort.Slice(sortedEnvFiles, func(i, j int) bool { return sortedEnvFiles[i].Name < sortedEnvFiles[j].Name })
+
+	var manifest bytes.Buffer
+
+	for _, envFile := range sortedEnvFiles {
+		digest := sha256.Sum256(envFile.Data)
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(digest[:]), envFile.Name)
+	}
+
+	return manifest.Bytes()
+}
+
+// Verify checks every env file against the manifest, and returns files which can be trusted. Files not listed in
+// the manifest are reported, unless they are ignored. Files listed, but missing from the directory are always
+// reported, as they indicate partial sync.
+func (m Manifest) Verify(envFiles []EnvFile, ignoreUnlisted bool) ([]EnvFile, []ManifestIssue) {
+	var issues []ManifestIssue
+
+	verifiedEnvFiles := make([]EnvFile, 0, len(envFiles))
+	foundNames := make(map[string]bool, len(envFiles))
+
+	for _, envFile := range envFiles {
+		foundNames[envFile.Name] = true
+
+		expectedDigest, ok := m[envFile.Name]
+		if !ok {
+			if !ignoreUnlisted {
+				issues = append(issues, ManifestIssue{Name: envFile.Name, Reason: "not listed in manifest"})
+			}
+
+			continue
+		}
+
+		if digest := sha256.Sum256(envFile.Data); hex.EncodeToString(digest[:]) != expectedDigest {
+			issues = append(issues, ManifestIssue{Name: envFile.Name, Reason: "digest mismatch"})
+
+			continue
+		}
+
+		verifiedEnvFiles = append(verifiedEnvFiles, envFile)
+	}
+
+	missingNames := make([]string, 0)
+
+	for name := range m {
+		if !foundNames[name] {
+			missingNames = append(missingNames, name)
+		}
+	}
+
+	sort.Strings(missingNames)
+
+	for _, name := range missingNames {
+		issues = append(issues, ManifestIssue{Name: name, Reason: "listed in manifest, but missing"})
+	}
+
+	return verifiedEnvFiles, issues
+}
+
+// Manifest generates SHA256SUMS manifest of an env directory, which can be verified with `--manifest`.
+func (c Cmd) Manifest(args []string) int {
+	var dir, output string
+
+	logger := c.subcommandLogger()
+
+	if len(args) == 0 || args[0] != "generate" {
+		logger.Error("unknown manifest command, expected `manifest generate`", LogFields{"args": args})
+
+		return 2
+	}
+
+	flagSet := c.newSubcommandFlagSet("manifest generate")
+	c.dirFlag(flagSet, &dir)
+	flagSet.StringVar(&output, "o", "", "Write manifest to file, relative to directory (default stdout)")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args[1:]); !ok {
+		return exitCode
+	}
+
+	envFiles, err := readEnvDir(dir)
+	if err != nil {
+		logger.Error("error reading variables from directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	if output == "" {
+		_, _ = c.Stdout.Write(generateManifest(envFiles))
+
+		return 0
+	}
+
+	outputPath := manifestPath(dir, output)
+	// manifest written to the directory does not list itself
+	envFiles = slices.DeleteFunc(envFiles, func(envFile EnvFile) bool { return isManifestFile(envFile, outputPath) })
+
+	if err := writeDirFile(dir, outputPath, generateManifest(envFiles), 0644, logger); err != nil {
+		logger.Error("error writing manifest", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	return 0
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_ParseManifest(t *testing.T) {
+	data := "# generated\n" +
+		"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7  A\n" +
+		"0263829989B6FD954F72BAAF2FC64BC2E2F01D692D4DE72986EA808F6E99813F *B C\r\n"
+
+	manifest, err := parseManifest([]byte(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(manifest) != 2 || manifest["A"][:8] != "87428fc5" || manifest["B C"][:8] != "02638299" {
+		t.Errorf("unexpected manifest: %v", manifest)
+	}
+
+	for _, invalidData := range []string{
+		"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7\n",
+		"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7 A\n",
+		"87428fc5  A\n",
+		"not-a-digest  A\n",
+	} {
+		if _, err := parseManifest([]byte(invalidData)); err == nil {
+			t.Errorf("expected error for %q, got none", invalidData)
+		}
+	}
+}
+
+func Test_ManifestVerify(t *testing.T) {
+	envFiles := []EnvFile{{Name: "A", Data: []byte("a\n")}, {Name: "B", Data: []byte("b\n")}}
+	manifest, _ := parseManifest(generateManifest(envFiles))
+
+	tamperedEnvFiles := []EnvFile{{Name: "B", Data: []byte("evil\n")}, {Name: "C", Data: []byte("c\n")}}
+
+	verifiedEnvFiles, issues := manifest.Verify(envFiles, false)
+	if len(verifiedEnvFiles) != 2 || len(issues) != 0 {
+		t.Errorf("expected all files to be verified, got %v (%v)", verifiedEnvFiles, issues)
+	}
+
+	_, issues = manifest.Verify(tamperedEnvFiles, false)
+	expectedIssues := []ManifestIssue{{"B", "digest mismatch"}, {"C", "not listed in manifest"}, {"A", "listed in manifest, but missing"}}
+
+	if len(issues) != len(expectedIssues) {
+		t.Fatalf("expected issues %v, got %v", expectedIssues, issues)
+	}
+
+	for i, expectedIssue := range expectedIssues {
+		if issues[i] != expectedIssue {
+			t.Errorf("expected issue %v, got %v", expectedIssue, issues[i])
+		}
+	}
+
+	verifiedEnvFiles, issues = manifest.Verify(append(envFiles, EnvFile{Name: "C", Data: []byte("c\n")}), true)
+	if len(verifiedEnvFiles) != 2 || len(issues) != 0 {
+		t.Errorf("expected unlisted file to be ignored, got %v (%v)", verifiedEnvFiles, issues)
+	}
+}
+
+func TestCmd_Manifest(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it generates manifest", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"B": "b\n", "A": "a\n"})
+
+		os.Args = []string{"envdir", "@manifest", "generate", "-d", dir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		expectedManifest := "87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7  A\n" +
+			"0263829989b6fd954f72baaf2fc64bc2e2f01d692d4de72986ea808f6e99813f  B\n"
+		if cmdStdout.String() != expectedManifest {
+			t.Errorf("expected manifest:\n%s\ngot:\n%s", expectedManifest, cmdStdout.String())
+		}
+	})
+
+	t.Run("it verifies directory against manifest", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"A": "a\n", "B": "b\n"})
+
+		os.Args = []string{"envdir", "@manifest", "generate", "-d", dir, "-o", "SHA256SUMS"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest", "SHA256SUMS", "sh", "-c", `echo "$A $B $SHA256SUMS"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "a b \n" {
+			t.Errorf("expected verified variables without manifest itself, got:\n%s", cmdStdout.String())
+		}
+
+		for name, data := range map[string]string{"B": "evil\n", "C": "c\n"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+				t.Fatalf("error creating env file: %v", err)
+			}
+		}
+		cmdStdout.Reset()
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest", "SHA256SUMS", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		for _, expectedLog := range []string{"name=B", `reason="digest mismatch"`, "name=C", `reason="not listed in manifest"`} {
+			if !strings.Contains(cmdStdout.String(), expectedLog) {
+				t.Errorf("expected %q in log, got:\n%s", expectedLog, cmdStdout.String())
+			}
+		}
+	})
+
+	t.Run("it fails on missing manifest", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--manifest", "SHA256SUMS", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d", exitCode)
+		}
+	})
+
+	t.Run("it fails on missing directory even without --fail", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", filepath.Join(t.TempDir(), "missing"), "--manifest", "SHA256SUMS", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails on unknown manifest command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@manifest", "verify"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaskMinLength = 8
+	maskReplacement      = "***"
+	// maskFlushDelay is how long held back bytes wait for more output, so prompts without newline are not stalled
+	maskFlushDelay = 100 * time.Millisecond
+)
+
+// MaskMatcher is an Aho-Corasick automaton, finding all patterns in a single pass over the input. Fail links are
+// resolved up front into a transition table, so every byte takes a single lookup. Bytes are mapped to classes first,
+// as patterns usually use only a fraction of all values, which keeps the table small.
+type MaskMatcher struct {
+	byteClass   [256]int32
+	classCount  int32
+	transitions []int32
+	depth       []int32
+	// matchLen is length of the longest pattern ending at the state, including ones reached through fail links
+	matchLen []int32
+}
+
+func NewMaskMatcher(patterns [][]byte) *MaskMatcher {
+	matcher := &MaskMatcher{classCount: 1}
+
+	// class 0 is left for bytes which are not part of any pattern
+	for _, pattern := range patterns {
+		for _, patternByte := range pattern {
+			if matcher.byteClass[patternByte] == 0 {
+				matcher.byteClass[patternByte] = matcher.classCount
+				matcher.classCount++
+			}
+		}
+	}
+
+	children := []map[int32]int32{{}}
+	matcher.depth = []int32{0}
+	matcher.matchLen = []int32{0}
+
+	for _, pattern := range patterns {
+		if len(pattern) == 0 {
+			continue
+		}
+
+		state := int32(0)
+
+		for _, patternByte := range pattern {
+			class := matcher.byteClass[patternByte]
+
+			next, ok := children[state][class]
+			if !ok {
+				next = int32(len(children))
+				children[state][class] = next
+				children = append(children, map[int32]int32{})
+				matcher.depth = append(matcher.depth, matcher.depth[state]+1)
+				matcher.matchLen = append(matcher.matchLen, 0)
+			}
+
+			state = next
+		}
+
+		matcher.matchLen[state] = int32(len(pattern))
+	}
+
+	// states are resolved breadth first, so transitions of their fail states, which are shallower, are always ready
+	matcher.transitions = make([]int32, len(children)*int(matcher.classCount))
+	fail := make([]int32, len(children))
+	queue := []int32{0}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for class := int32(0); class < matcher.classCount; class++ {
+			next, ok := children[state][class]
+
+			switch {
+			case !ok && state == 0:
+			case !ok:
+				matcher.transitions[state*matcher.classCount+class] = matcher.transitions[fail[state]*matcher.classCount+class]
+			default:
+				if state != 0 {
+					fail[next] = matcher.transitions[fail[state]*matcher.classCount+class]
+				}
+
+				matcher.matchLen[next] = max(matcher.matchLen[next], matcher.matchLen[fail[next]])
+				matcher.transitions[state*matcher.classCount+class] = next
+
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return matcher
+}
+
+// Step returns state after reading the next byte.
+func (m *MaskMatcher) Step(state int32, nextByte byte) int32 {
+	return m.transitions[state*m.classCount+m.byteClass[nextByte]]
+}
+
+// MaskingWriter replaces every pattern written to it with `***`. Bytes which can still turn out to be a part of
+// a pattern are held back until the next write, so patterns split across writes are masked too. If nothing more is
+// written within flushDelay, held back bytes are written anyway.
+type MaskingWriter struct {
+	mutex   sync.Mutex
+	output  io.Writer
+	matcher *MaskMatcher
+	state   int32
+	pending []byte
+	// masks are sorted, non-overlapping ranges of pending and written bytes to be replaced
+	masks  [][2]int
+	buffer []byte
+
+	flushDelay time.Duration
+	flushTimer *time.Timer
+	// writeCount invalidates a delayed flush scheduled before the last write
+	writeCount uint64
+}
+
+func (mw *MaskingWriter) addMask(start, end int) {
+	for len(mw.masks) > 0 && mw.masks[len(mw.masks)-1][1] > start {
+		lastMask := mw.masks[len(mw.masks)-1]
+		start, end = min(start, lastMask[0]), max(end, lastMask[1])
+		mw.masks = mw.masks[:len(mw.masks)-1]
+	}
+
+	mw.masks = append(mw.masks, [2]int{start, end})
+}
+
+// flush writes pending bytes followed by data up to boundary, which is moved back if it splits a mask. The rest is
+// kept as pending.
+func (mw *MaskingWriter) flush(data []byte, boundary int) error {
+	flushedMasks := 0
+
+	for _, mask := range mw.masks {
+		if mask[1] > boundary {
+			boundary = min(boundary, mask[0])
+
+			break
+		}
+
+		flushedMasks++
+	}
+
+	var output []byte
+
+	pendingLen := len(mw.pending)
+
+	switch {
+	case boundary == 0:
+	case flushedMasks == 0 && pendingLen == 0:
+		output = data[:boundary]
+	default:
+		// segment returns bytes from start to end, as if pending and data were a single slice
+		segment := func(start, end int) []byte {
+			switch {
+			case end <= pendingLen:
+				return mw.pending[start:end]
+			case start >= pendingLen:
+				return data[start-pendingLen : end-pendingLen]
+			default:
+				return append(mw.pending[start:pendingLen:pendingLen], data[:end-pendingLen]...)
+			}
+		}
+
+		output = mw.buffer[:0]
+		position := 0
+
+		for _, mask := range mw.masks[:flushedMasks] {
+			output = append(append(output, segment(position, mask[0])...), maskReplacement...)
+			position = mask[1]
+		}
+
+		output = append(output, segment(position, boundary)...)
+		mw.buffer = output
+	}
+
+	if boundary < pendingLen {
+		mw.pending = append(mw.pending[boundary:pendingLen:pendingLen], data...)
+	} else {
+		mw.pending = append(mw.pending[:0], data[boundary-pendingLen:]...)
+	}
+
+	mw.masks = append(mw.masks[:0], mw.masks[flushedMasks:]...)
+
+	for i := range mw.masks {
+		mw.masks[i][0] -= boundary
+		mw.masks[i][1] -= boundary
+	}
+
+	if len(output) == 0 {
+		return nil
+	}
+
+	_, err := mw.output.Write(output)
+
+	return err
+}
+
+func (mw *MaskingWriter) Write(data []byte) (int, error) {
+	mw.mutex.Lock()
+	defer mw.mutex.Unlock()
+
+	mw.stopFlushTimer()
+
+	pendingLen := len(mw.pending)
+
+	for i, dataByte := range data {
+		mw.state = mw.matcher.Step(mw.state, dataByte)
+
+		if matchLen := int(mw.matcher.matchLen[mw.state]); matchLen > 0 {
+			mw.addMask(pendingLen+i+1-matchLen, pendingLen+i+1)
+		}
+	}
+
+	// the current state is the longest suffix which can still become a pattern, everything before it is final
+	if err := mw.flush(data, pendingLen+len(data)-int(mw.matcher.depth[mw.state])); err != nil {
+		return 0, err
+	}
+
+	if len(mw.pending) > 0 && mw.flushDelay > 0 {
+		writeCount := mw.writeCount
+		mw.flushTimer = time.AfterFunc(mw.flushDelay, func() {
+			mw.mutex.Lock()
+			defer mw.mutex.Unlock()
+
+			if mw.writeCount == writeCount {
+				_ = mw.flushPending()
+			}
+		})
+	}
+
+	return len(data), nil
+}
+
+func (mw *MaskingWriter) stopFlushTimer() {
+	mw.writeCount++
+
+	if mw.flushTimer != nil {
+		mw.flushTimer.Stop()
+		mw.flushTimer = nil
+	}
+}
+
+func (mw *MaskingWriter) flushPending() error {
+	mw.state = 0
+
+	return mw.flush(nil, len(mw.pending))
+}
+
+// Flush writes all bytes held back, once nothing more is going to be written.
+func (mw *MaskingWriter) Flush() error {
+	mw.mutex.Lock()
+	defer mw.mutex.Unlock()
+
+	mw.stopFlushTimer()
+
+	return mw.flushPending()
+}
+
+func NewMaskingWriter(output io.Writer, matcher *MaskMatcher) *MaskingWriter {
+	return &MaskingWriter{output: output, matcher: matcher, flushDelay: maskFlushDelay}
+}
+
+// maskPatterns returns values at least minLength bytes long, optionally with their base64 and URL encoded forms.
+func maskPatterns(values []string, minLength int, encoded bool) [][]byte {
+	seen := make(map[string]bool)
+	patterns := make([][]byte, 0, len(values))
+
+	for _, value := range values {
+		if len(value) < minLength {
+			continue
+		}
+
+		forms := []string{value}
+		if encoded {
+			forms = append(forms,
+				base64.StdEncoding.EncodeToString([]byte(value)),
+				base64.RawStdEncoding.EncodeToString([]byte(value)),
+				base64.URLEncoding.EncodeToString([]byte(value)),
+				base64.RawURLEncoding.EncodeToString([]byte(value)),
+				url.QueryEscape(value),
+				url.PathEscape(value),
+			)
+		}
+
+		for _, form := range forms {
+			if !seen[form] {
+				seen[form] = true
+				patterns = append(patterns, []byte(form))
+			}
+		}
+	}
+
+	return patterns
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MaskingWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		input    string
+		expected string
+	}{
+		{"it passes output without patterns", nil, "hello world", "hello world"},
+		{"it masks every occurrence", []string{"s3cr3t"}, "a s3cr3t b s3cr3t", "a *** b ***"},
+		{"it keeps partial matches", []string{"s3cr3t"}, "s3cr s3cr3 s3cr3t s3c", "s3cr s3cr3 *** s3c"},
+		{"it masks overlapping patterns once", []string{"abcd", "bc", "cdef"}, "xabcdefy", "x***y"},
+		{"it masks pattern inside other one", []string{"bc", "abcd"}, "xabcdy abcx", "x***y a***x"},
+		{"it masks repeated pattern", []string{"aa"}, "aaaaa b", "*** b"},
+		{"it masks adjacent patterns separately", []string{"foo", "bar"}, "foobar", "******"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns := make([][]byte, 0, len(tt.patterns))
+			for _, pattern := range tt.patterns {
+				patterns = append(patterns, []byte(pattern))
+			}
+
+			matcher := NewMaskMatcher(patterns)
+
+			// every split of writes has to result in the same output
+			for chunkSize := 1; chunkSize <= len(tt.input); chunkSize++ {
+				var output bytes.Buffer
+
+				maskingWriter := NewMaskingWriter(&output, matcher)
+
+				for start := 0; start < len(tt.input); start += chunkSize {
+					written, err := maskingWriter.Write([]byte(tt.input[start:min(start+chunkSize, len(tt.input))]))
+					if err != nil || written != min(chunkSize, len(tt.input)-start) {
+						t.Fatalf("unexpected write result %d, %v", written, err)
+					}
+				}
+
+				_ = maskingWriter.Flush()
+
+				if output.String() != tt.expected {
+					t.Errorf("expected %q with %d bytes writes, got %q", tt.expected, chunkSize, output.String())
+				}
+			}
+		})
+	}
+}
+
+// naiveMask replaces every occurrence of patterns, merging overlapping ones.
+func naiveMask(input string, patterns []string) string {
+	masks := make([][2]int, 0)
+
+	for start := range input {
+		end := start
+
+		for _, pattern := range patterns {
+			if strings.HasPrefix(input[start:], pattern) {
+				end = max(end, start+len(pattern))
+			}
+		}
+
+		if end == start {
+			continue
+		}
+
+		if len(masks) > 0 && masks[len(masks)-1][1] > start {
+			masks[len(masks)-1][1] = max(masks[len(masks)-1][1], end)
+		} else {
+			masks = append(masks, [2]int{start, end})
+		}
+	}
+
+	output, position := "", 0
+	for _, mask := range masks {
+		output += input[position:mask[0]] + maskReplacement
+		position = mask[1]
+	}
+
+	return output + input[position:]
+}
+
+func Test_MaskingWriterFlushDelay(t *testing.T) {
+	var output bytes.Buffer
+
+	maskingWriter := NewMaskingWriter(&output, NewMaskMatcher([][]byte{[]byte("s3cr3t")}))
+	maskingWriter.flushDelay = 10 * time.Millisecond
+
+	flushed := func() string {
+		maskingWriter.mutex.Lock()
+		defer maskingWriter.mutex.Unlock()
+
+		return output.String()
+	}
+
+	if _, err := maskingWriter.Write([]byte("Password for s3c")); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	if flushed() != "Password for " {
+		t.Errorf("expected possible pattern to be held back, got %q", flushed())
+	}
+
+	for deadline := time.Now().Add(time.Second); flushed() != "Password for s3c" && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if flushed() != "Password for s3c" {
+		t.Errorf("expected held back bytes to be flushed after delay, got %q", flushed())
+	}
+}
+
+func Test_MaskingWriterRandom(t *testing.T) {
+	randomString := func(length int) string {
+		randomBytes := make([]byte, length)
+		_, _ = rand.Read(randomBytes)
+
+		for i := range randomBytes {
+			randomBytes[i] = "abc"[randomBytes[i]%3]
+		}
+
+		return string(randomBytes)
+	}
+
+	for i := 0; i < 200; i++ {
+		patterns := []string{randomString(2), randomString(3), randomString(5)}
+		matcherPatterns := [][]byte{[]byte(patterns[0]), []byte(patterns[1]), []byte(patterns[2])}
+		input := randomString(64)
+
+		var output bytes.Buffer
+
+		maskingWriter := NewMaskingWriter(&output, NewMaskMatcher(matcherPatterns))
+		for start := 0; start < len(input); start += 7 {
+			_, _ = maskingWriter.Write([]byte(input[start:min(start+7, len(input))]))
+		}
+
+		_ = maskingWriter.Flush()
+
+		if expected := naiveMask(input, patterns); output.String() != expected {
+			t.Fatalf("expected %q for %q with %q, got %q", expected, input, patterns, output.String())
+		}
+	}
+}
+
+func Test_MaskPatterns(t *testing.T) {
+	values := []string{"abc", "p@ss word", "p@ss word"}
+
+	if patterns := maskPatterns(values, 4, false); len(patterns) != 1 || string(patterns[0]) != "p@ss word" {
+		t.Errorf("expected only long enough value once, got %q", patterns)
+	}
+
+	patterns := maskPatterns(values, 4, true)
+	for _, expectedPattern := range []string{"p@ss word", "cEBzcyB3b3Jk", "p%40ss+word", "p@ss%20word"} {
+		if !bytes.Contains(bytes.Join(patterns, []byte("\n")), []byte(expectedPattern)) {
+			t.Errorf("expected %q in patterns, got %q", expectedPattern, patterns)
+		}
+	}
+}
+
+func TestCmd_Mask(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+	dir := writeEnvDir(t, map[string]string{"PASSWORD": "hunter2hunter2\n", "PORT": "8080\n"})
+
+	os.Args = []string{"envdir", "-d", dir, "--mask", "--mask-encoded", "sh", "-c",
+		`printf "password=%s port=%s\n" "$PASSWORD" "$PORT"; printf "%s" "$PASSWORD" | base64 >&2`}
+	if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+		t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+	}
+
+	if cmdStdout.String() != "password=*** port=8080\n" || cmdStderr.String() != "***\n" {
+		t.Errorf("expected masked output, got:\n%s\n%s", cmdStdout.String(), cmdStderr.String())
+	}
+}
+
+func benchmarkMaskingWriter(b *testing.B, patternCount int) {
+	patterns := make([][]byte, 0, patternCount)
+
+	for i := 0; i < patternCount; i++ {
+		secret := make([]byte, 16)
+		_, _ = rand.Read(secret)
+		patterns = append(patterns, []byte(hex.EncodeToString(secret)))
+	}
+
+	matcher := NewMaskMatcher(patterns)
+	line := "level=info msg=\"connected to database\" host=db.internal token=" + string(patterns[0]) + "\n"
+	chunk := []byte(strings.Repeat(line, 4096/len(line)))
+
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+
+	maskingWriter := NewMaskingWriter(io.Discard, matcher)
+
+	for i := 0; i < b.N; i++ {
+		_, _ = maskingWriter.Write(chunk)
+	}
+}
+
+func BenchmarkMaskingWriter_1Pattern(b *testing.B) {
+	benchmarkMaskingWriter(b, 1)
+}
+
+func BenchmarkMaskingWriter_100Patterns(b *testing.B) {
+	benchmarkMaskingWriter(b, 100)
+}
+
+func BenchmarkMaskingWriter_1000Patterns(b *testing.B) {
+	benchmarkMaskingWriter(b, 1000)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const memfdSeals = unix.F_SEAL_SEAL | unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE
+
+// createSealedMemfd creates an anonymous in-memory file holding value, which cannot be modified anymore.
+func createSealedMemfd(name, value string) (*os.File, error) {
+	fd, err := unix.MemfdCreate("envdir:"+name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, fmt.Errorf("creating memfd: %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), "memfd:"+name)
+
+	if _, err := file.WriteString(value); err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("writing memfd: %w", err)
+	}
+
+	// offset is shared with subprocess, which reads from the beginning when it uses the descriptor directly
+	if _, err := file.Seek(0, 0); err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("rewinding memfd: %w", err)
+	}
+
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, memfdSeals); err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("sealing memfd: %w", err)
+	}
+
+	return file, nil
+}
+
+// setupMemfdSecrets passes each secret to subprocess as inherited memfd, and exports NAME_FILE or NAME_FD variable
+// pointing at it instead of the value.
+func setupMemfdSecrets(cmd *exec.Cmd, secrets []EnvVar, exportAs string, logger *Logger) error {
+	for _, secret := range secrets {
+		file, err := createSealedMemfd(secret.Name, secret.Value)
+		if err != nil {
+			return fmt.Errorf("passing %s: %w", secret.Name, err)
+		}
+
+		// extra files are numbered from 3, after stdin, stdout and stderr
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+		fd := strconv.Itoa(2 + len(cmd.ExtraFiles))
+
+		if exportAs == "fd" {
+			cmd.Env = append(cmd.Env, secret.Name+"_FD="+fd)
+		} else {
+			cmd.Env = append(cmd.Env, secret.Name+"_FILE=/proc/self/fd/"+fd)
+		}
+
+		logger.Debug("passing value through memfd", LogFields{"name": secret.Name, "fd": fd})
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCmd_Memfd(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "DB_PASSWORD"), []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("error creating env file: %v", err)
+	}
+
+	var tests = []struct {
+		name           string
+		args           []string
+		script         string
+		expectedOutput string
+	}{
+		{
+			"it passes variables as memfd files",
+			[]string{"--memfd", "*_PASSWORD"},
+			`echo "$DB_PASSWORD_FILE"; cat "$DB_PASSWORD_FILE"; echo; grep -c "DB_PASSWORD=" /proc/$$/environ || true`,
+			"/proc/self/fd/3\nsecret\n0\n",
+		},
+		{
+			"it passes variables as memfd descriptors",
+			[]string{"--memfd", "DB_PASSWORD", "--memfd-env", "fd"},
+			`echo "$DB_PASSWORD_FD"; cat <&"$DB_PASSWORD_FD"; echo`,
+			"3\nsecret\n",
+		},
+		{
+			"it seals memfd files",
+			[]string{"--memfd", "DB_PASSWORD"},
+			`(echo changed > "$DB_PASSWORD_FILE") 2>/dev/null || echo sealed; cat "$DB_PASSWORD_FILE"; echo`,
+			"sealed\nsecret\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+			os.Args = append(append([]string{"envdir", "-d", dir}, tt.args...), "sh", "-c", tt.script)
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 0 {
+				t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+			}
+
+			if cmdStdout.String() != tt.expectedOutput {
+				t.Errorf("expected output %q, got %q", tt.expectedOutput, cmdStdout.String())
+			}
+		})
+	}
+}
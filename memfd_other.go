@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+func setupMemfdSecrets(_ *exec.Cmd, _ []EnvVar, _ string, _ *Logger) error {
+	return errProcessSetupNotSupported
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setupHiddenDir moves the forking thread to a private mount namespace, where dir is covered with an empty read-only
+// tmpfs. The subprocess inherits the namespace, while envdir itself keeps seeing the original directory.
+func setupHiddenDir(setup *ProcessSetup, dir string, logger *Logger) error {
+	// user namespaces would let unprivileged users do the same, but they cannot be created by multithreaded processes
+	if !hasEffectiveCapability(unix.CAP_SYS_ADMIN) {
+		return errors.New("private mount namespace requires CAP_SYS_ADMIN")
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		logger.Debug("directory does not exist, nothing to hide", LogFields{"dir": dir})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logger.Info("hiding directory in private mount namespace", LogFields{"dir": dir})
+
+	setup.OnThread(func() error {
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("creating mount namespace: %w", err)
+		}
+
+		// mounts have to be private, otherwise tmpfs would be propagated back to the original namespace
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("making mounts private: %w", err)
+		}
+
+		flags := uintptr(unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+		if err := unix.Mount("tmpfs", dir, "tmpfs", flags, "mode=0755"); err != nil {
+			return fmt.Errorf("mounting tmpfs over %s: %w", dir, err)
+		}
+
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCmd_HideSecretsDir(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it hides secrets directory from command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if !hasEffectiveCapability(unix.CAP_SYS_ADMIN) {
+			t.Skip("private mount namespace requires CAP_SYS_ADMIN")
+		}
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "TOKEN"), []byte("secret\n"), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+
+		script := `echo "$TOKEN"; ls -A "$1"; test -e "$1/TOKEN" || echo hidden; touch "$1/file" 2>/dev/null || echo read-only`
+		os.Args = []string{"envdir", "-d", dir, "--hide-secrets-dir", "sh", "-c", script, "sh", dir}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "secret\nhidden\nread-only\n" {
+			t.Errorf("expected secrets directory to be hidden, got:\n%s", cmdStdout.String())
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "TOKEN")); err != nil {
+			t.Errorf("expected secrets directory to stay visible for envdir, got %v", err)
+		}
+	})
+
+	t.Run("it refuses to run command without privileges", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if hasEffectiveCapability(unix.CAP_SYS_ADMIN) {
+			t.Skip("private mount namespace can be created with CAP_SYS_ADMIN")
+		}
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--hide-secrets-dir", "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d", exitCode)
+		}
+	})
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func setupHiddenDir(_ *ProcessSetup, _ string, _ *Logger) error {
+	return errProcessSetupNotSupported
+}
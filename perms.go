@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PermIssue is an insecure permission or ownership of a secret file, or of a directory on the way to it.
+type PermIssue struct {
+	Path   string
+	Reason string
+}
+
+// trustedOwner checks whether uid can be trusted to own secrets, which is the case for root and the current user.
+func trustedOwner(uid uint32) bool {
+	return uid == 0 || uid == uint32(os.Geteuid())
+}
+
+func checkFilePerms(path string, info os.FileInfo) []PermIssue {
+	var issues []PermIssue
+
+	if info.Mode().Perm()&0044 != 0 {
+		issues = append(issues, PermIssue{Path: path, Reason: "group or world readable"})
+	}
+
+	if info.Mode().Perm()&0022 != 0 {
+		issues = append(issues, PermIssue{Path: path, Reason: "group or world writable"})
+	}
+
+	if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		issues = append(issues, PermIssue{Path: path, Reason: "setuid or setgid bit set"})
+	}
+
+	if uid, err := fileOwner(info); err == nil && !trustedOwner(uid) {
+		issues = append(issues, PermIssue{Path: path, Reason: fmt.Sprintf("owned by untrusted uid %d", uid)})
+	}
+
+	return issues
+}
+
+// checkDirPerms checks a directory containing secrets, which can be writable by others only if it has sticky bit
+// and is owned by root (like /tmp), so files in it cannot be replaced by anyone else.
+func checkDirPerms(path string, info os.FileInfo) []PermIssue {
+	uid, err := fileOwner(info)
+	if err != nil {
+		return nil
+	}
+
+	if !trustedOwner(uid) {
+		return []PermIssue{{Path: path, Reason: fmt.Sprintf("parent directory owned by untrusted uid %d", uid)}}
+	}
+
+	if info.Mode().Perm()&0022 != 0 && (info.Mode()&os.ModeSticky == 0 || uid != 0) {
+		return []PermIssue{{Path: path, Reason: "parent directory group or world writable"}}
+	}
+
+	return nil
+}
+
+// checkParentDirsPerms checks dir and all its parents, skipping ones checked already.
+func checkParentDirsPerms(dir string, checkedDirs map[string]bool) ([]PermIssue, error) {
+	var issues []PermIssue
+
+	for ; !checkedDirs[dir]; dir = filepath.Dir(dir) {
+		checkedDirs[dir] = true
+
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		issues = append(issues, checkDirPerms(dir, dirInfo)...)
+	}
+
+	return issues, nil
+}
+
+// checkEnvFilesPerms checks env files the same way ssh checks private keys, including all their parent directories.
+// Symlinked files are checked together with the link and directories leading to it, as they can be replaced there.
+func checkEnvFilesPerms(envPaths []string) ([]PermIssue, error) {
+	var issues []PermIssue
+
+	checkedDirs := make(map[string]bool)
+
+	for _, envPath := range envPaths {
+		realPath, err := filepath.EvalSymlinks(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(realPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := fileOwner(info); err != nil {
+			return nil, err
+		}
+
+		issues = append(issues, checkFilePerms(envPath, info)...)
+
+		linkInfo, err := os.Lstat(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if uid, err := fileOwner(linkInfo); err == nil && linkInfo.Mode()&os.ModeSymlink != 0 && !trustedOwner(uid) {
+			issues = append(issues, PermIssue{Path: envPath, Reason: fmt.Sprintf("symlink owned by untrusted uid %d", uid)})
+		}
+
+		absPath, err := filepath.Abs(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range []string{filepath.Dir(absPath), filepath.Dir(realPath)} {
+			dirIssues, err := checkParentDirsPerms(dir, checkedDirs)
+			if err != nil {
+				return nil, err
+			}
+
+			issues = append(issues, dirIssues...)
+		}
+	}
+
+	return issues, nil
+}
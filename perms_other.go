@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func fileOwner(_ os.FileInfo) (uint32, error) {
+	return 0, errors.New("checking file ownership is not supported on this platform")
+}
+
+func chownLike(_ *os.File, _ os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func createPermsDir(t *testing.T, files map[string]os.FileMode) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+
+	dir := t.TempDir()
+
+	for name, mode := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("value\n"), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("error changing mode of env file: %v", err)
+		}
+	}
+
+	return dir
+}
+
+func Test_CheckEnvFilesPerms(t *testing.T) {
+	t.Run("it reports every insecure file", func(t *testing.T) {
+		dir := createPermsDir(t, map[string]os.FileMode{
+			"SECURE":   0600,
+			"READABLE": 0640,
+			"WRITABLE": 0602,
+			"SETUID":   0600 | os.ModeSetuid,
+		})
+
+		issues, err := checkEnvFilesPerms([]string{
+			filepath.Join(dir, "SECURE"), filepath.Join(dir, "READABLE"), filepath.Join(dir, "WRITABLE"), filepath.Join(dir, "SETUID"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectedIssues := []PermIssue{
+			{Path: filepath.Join(dir, "READABLE"), Reason: "group or world readable"},
+			{Path: filepath.Join(dir, "WRITABLE"), Reason: "group or world writable"},
+			{Path: filepath.Join(dir, "SETUID"), Reason: "setuid or setgid bit set"},
+		}
+
+		if len(issues) != len(expectedIssues) {
+			t.Fatalf("expected issues %v, got %v", expectedIssues, issues)
+		}
+
+		for i, expectedIssue := range expectedIssues {
+			if issues[i] != expectedIssue {
+				t.Errorf("expected issue %v, got %v", expectedIssue, issues[i])
+			}
+		}
+	})
+
+	t.Run("it reports writable parent directories", func(t *testing.T) {
+		dir := createPermsDir(t, map[string]os.FileMode{"SECURE": 0600})
+		if err := os.Chmod(dir, 0777); err != nil {
+			t.Fatalf("error changing mode of directory: %v", err)
+		}
+
+		issues, err := checkEnvFilesPerms([]string{filepath.Join(dir, "SECURE")})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(issues) != 1 || issues[0] != (PermIssue{Path: dir, Reason: "parent directory group or world writable"}) {
+			t.Errorf("expected writable parent directory issue, got %v", issues)
+		}
+	})
+
+	t.Run("it reports writable directories holding symlinks", func(t *testing.T) {
+		dir := createPermsDir(t, map[string]os.FileMode{"SECURE": 0600})
+		linksDir := t.TempDir()
+
+		if err := os.Symlink(filepath.Join(dir, "SECURE"), filepath.Join(linksDir, "SECURE")); err != nil {
+			t.Fatalf("error creating symlink: %v", err)
+		}
+
+		if err := os.Chmod(linksDir, 0777); err != nil {
+			t.Fatalf("error changing mode of directory: %v", err)
+		}
+
+		issues, err := checkEnvFilesPerms([]string{filepath.Join(linksDir, "SECURE")})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(issues) != 1 || issues[0] != (PermIssue{Path: linksDir, Reason: "parent directory group or world writable"}) {
+			t.Errorf("expected writable symlink directory issue, got %v", issues)
+		}
+	})
+
+	t.Run("it reports symlinks with untrusted owners", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("changing file owner requires root")
+		}
+
+		dir := createPermsDir(t, map[string]os.FileMode{"SECURE": 0600})
+		linkPath := filepath.Join(dir, "LINK")
+
+		if err := os.Symlink(filepath.Join(dir, "SECURE"), linkPath); err != nil {
+			t.Fatalf("error creating symlink: %v", err)
+		}
+
+		if err := os.Lchown(linkPath, 4321, 4321); err != nil {
+			t.Fatalf("error changing owner of symlink: %v", err)
+		}
+
+		issues, err := checkEnvFilesPerms([]string{linkPath})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(issues) != 1 || issues[0] != (PermIssue{Path: linkPath, Reason: "symlink owned by untrusted uid 4321"}) {
+			t.Errorf("expected untrusted symlink owner issue, got %v", issues)
+		}
+	})
+
+	t.Run("it reports untrusted owners", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("changing file owner requires root")
+		}
+
+		dir := createPermsDir(t, map[string]os.FileMode{"FOREIGN": 0600})
+		if err := os.Chown(filepath.Join(dir, "FOREIGN"), 4321, 4321); err != nil {
+			t.Fatalf("error changing owner of env file: %v", err)
+		}
+
+		issues, err := checkEnvFilesPerms([]string{filepath.Join(dir, "FOREIGN")})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(issues) != 1 || issues[0].Reason != "owned by untrusted uid 4321" {
+			t.Errorf("expected untrusted owner issue, got %v", issues)
+		}
+	})
+}
+
+func TestCmd_StrictPerms(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var tests = []struct {
+		strictPerms      string
+		expectedExitCode int
+		expectedLog      string
+	}{
+		{"off", 0, ""},
+		{"warn", 0, "level=WARN msg=\"insecure permissions\""},
+		{"error", 3, "level=ERROR msg=\"insecure permissions\""},
+	}
+
+	for _, tt := range tests {
+		t.Run("it checks permissions in "+tt.strictPerms+" mode", func(t *testing.T) {
+			var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+			dir := createPermsDir(t, map[string]os.FileMode{"SECURE": 0600, "READABLE": 0644})
+			os.Args = []string{"envdir", "-d", dir, "--strict-perms", tt.strictPerms, "true"}
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != tt.expectedExitCode {
+				t.Errorf("expected exit code %d, got %d:\n%s", tt.expectedExitCode, exitCode, cmdStdout.String())
+			}
+
+			if tt.expectedLog != "" && !strings.Contains(cmdStdout.String(), tt.expectedLog) {
+				t.Errorf("expected %q in log, got:\n%s", tt.expectedLog, cmdStdout.String())
+			}
+
+			if strings.Contains(cmdStdout.String(), "SECURE") {
+				t.Errorf("expected secure file not to be reported, got:\n%s", cmdStdout.String())
+			}
+		})
+	}
+}
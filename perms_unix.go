@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func fileOwner(info os.FileInfo) (uint32, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("reading file owner")
+	}
+
+	return stat.Uid, nil
+}
+
+// chownLike gives file the owner and group of info, failing when the caller is not allowed to.
+func chownLike(file *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("reading file owner")
+	}
+
+	current, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if currentStat, ok := current.Sys().(*syscall.Stat_t); ok && currentStat.Uid == stat.Uid && currentStat.Gid == stat.Gid {
+		return nil
+	}
+
+	return file.Chown(int(stat.Uid), int(stat.Gid))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setupUmask sets umask of the forking thread only, which has its own copy of filesystem attributes once it is
+// unshared from the rest of envdir.
+func setupUmask(setup *ProcessSetup, umask os.FileMode) error {
+	setup.OnThread(func() error {
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			return fmt.Errorf("unsharing filesystem attributes: %w", err)
+		}
+
+		unix.Umask(int(umask))
+
+		return nil
+	})
+
+	return nil
+}
+
+// setupNice sets nice level of the forking thread, as on Linux it is a per-thread attribute inherited on fork.
+func setupNice(setup *ProcessSetup, nice int) error {
+	setup.OnThread(func() error {
+		return unix.Setpriority(unix.PRIO_PROCESS, 0, nice)
+	})
+
+	return nil
+}
+
+// setupOOMScoreAdj adjusts envdir itself right before the subprocess is forked, as OOM score is shared by all threads
+// and inherited on fork, and restores the previous one once the subprocess has been started.
+func setupOOMScoreAdj(setup *ProcessSetup, oomScoreAdj int) error {
+	setup.OnFork(func() (func(), error) {
+		previous, err := os.ReadFile("/proc/self/oom_score_adj")
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(oomScoreAdj)), 0); err != nil {
+			return nil, err
+		}
+
+		return func() { _ = os.WriteFile("/proc/self/oom_score_adj", previous, 0) }, nil
+	})
+
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func setupUmask(_ *ProcessSetup, _ os.FileMode) error {
+	return errProcessSetupNotSupported
+}
+
+func setupNice(_ *ProcessSetup, _ int) error {
+	return errProcessSetupNotSupported
+}
+
+func setupOOMScoreAdj(_ *ProcessSetup, _ int) error {
+	return errProcessSetupNotSupported
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ProcessSetup collects adjustments of the subprocess, which cannot be expressed with exec.Cmd alone.
+//
+// Fork hooks change process-wide attributes of envdir right before the subprocess is forked, so it inherits them,
+// and return a function which reverts the change once the subprocess has been started. Thread hooks run on
+// a dedicated OS thread, right before the subprocess is forked from it, so thread-scoped attributes set there are
+// inherited by the subprocess without affecting the rest of envdir.
+type ProcessSetup struct {
+	forkHooks   []func() (func(), error)
+	threadHooks []func() error
+}
+
+func (ps *ProcessSetup) OnFork(hook func() (func(), error)) {
+	ps.forkHooks = append(ps.forkHooks, hook)
+}
+
+func (ps *ProcessSetup) OnThread(hook func() error) {
+	ps.threadHooks = append(ps.threadHooks, hook)
+}
+
+func (ps *ProcessSetup) empty() bool {
+	return len(ps.forkHooks) == 0 && len(ps.threadHooks) == 0
+}
+
+// setupProcess applies process related options to the subprocess, once its environment has been built.
+func setupProcess(cmd *exec.Cmd, flags *Flags, logger *Logger) (*ProcessSetup, error) {
+	setup := &ProcessSetup{}
+
+	if flags.Chdir != "" {
+		if info, err := os.Stat(flags.Chdir); err != nil {
+			return nil, fmt.Errorf("changing directory: %w", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("changing directory: %s is not a directory", flags.Chdir)
+		}
+
+		cmd.Dir = flags.Chdir
+	}
+
+	if flags.Argv0 != "" {
+		cmd.Args[0] = flags.Argv0
+	}
+
+	if flags.User != "" {
+		if err := setupUser(cmd, flags.User, logger); err != nil {
+			return nil, fmt.Errorf("switching user: %w", err)
+		}
+	}
+
+	if len(flags.Limits) > 0 {
+		if err := setupRlimits(cmd, setup, flags.Limits, logger); err != nil {
+			return nil, fmt.Errorf("setting resource limits: %w", err)
+		}
+	}
+
+	if flags.Umask != nil {
+		if err := setupUmask(setup, *flags.Umask); err != nil {
+			return nil, fmt.Errorf("setting umask: %w", err)
+		}
+	}
+
+	if flags.Nice != nil {
+		if err := setupNice(setup, *flags.Nice); err != nil {
+			return nil, fmt.Errorf("setting nice level: %w", err)
+		}
+	}
+
+	if flags.OOMScoreAdj != nil {
+		if err := setupOOMScoreAdj(setup, *flags.OOMScoreAdj); err != nil {
+			return nil, fmt.Errorf("setting OOM score adjustment: %w", err)
+		}
+	}
+
+	if flags.NoNewPrivs {
+		if err := setupNoNewPrivs(setup); err != nil {
+			return nil, fmt.Errorf("setting no_new_privs: %w", err)
+		}
+	}
+
+	if flags.DropCaps || len(flags.CapKeep) > 0 {
+		if err := setupCapabilities(cmd, setup, flags.CapKeep, flags.AmbientCaps, logger); err != nil {
+			return nil, fmt.Errorf("dropping capabilities: %w", err)
+		}
+	}
+
+	// mount namespace is set up before Landlock, which does not allow sandboxed threads to mount anything
+	if flags.HideSecretsDir {
+		if err := setupHiddenDir(setup, flags.Dir, logger); err != nil {
+			return nil, fmt.Errorf("hiding secrets directory: %w", err)
+		}
+	}
+
+	if len(flags.FsRO) > 0 || len(flags.FsRW) > 0 || flags.DenySecretsDir {
+		if err := setupLandlock(setup, flags, logger); err != nil {
+			return nil, fmt.Errorf("setting up filesystem sandbox: %w", err)
+		}
+	}
+
+	return setup, nil
+}
+
+var errProcessSetupNotSupported = errors.New("not supported on this platform")
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+func startProcess(cmd *exec.Cmd, setup *ProcessSetup) error {
+	if setup.empty() {
+		return cmd.Start()
+	}
+
+	// fork hooks run before thread hooks, which may drop privileges needed to change (and revert) envdir attributes
+	revert, err := setup.runForkHooks()
+	if err != nil {
+		return err
+	}
+	defer revert()
+
+	forked := make(chan error)
+
+	go func() {
+		// the thread is never unlocked, so it is terminated (or left idle, if it is the main thread) together with
+		// this goroutine, instead of being reused by the runtime with attributes meant for the subprocess only
+		runtime.LockOSThread()
+
+		forked <- setup.fork(cmd)
+	}()
+
+	return <-forked
+}
+
+// runForkHooks applies fork hooks and returns a function reverting all of them, in reverse order.
+func (ps *ProcessSetup) runForkHooks() (func(), error) {
+	reverts := make([]func(), 0, len(ps.forkHooks))
+	revert := func() {
+		for i := len(reverts) - 1; i >= 0; i-- {
+			reverts[i]()
+		}
+	}
+
+	for _, hook := range ps.forkHooks {
+		hookRevert, err := hook()
+		if err != nil {
+			revert()
+
+			return nil, err
+		}
+
+		reverts = append(reverts, hookRevert)
+	}
+
+	return revert, nil
+}
+
+// fork runs thread hooks and starts the subprocess.
+func (ps *ProcessSetup) fork(cmd *exec.Cmd) error {
+	for _, hook := range ps.threadHooks {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+
+	return cmd.Start()
+}
+
+// hasEffectiveCapability checks whether envdir has capability in its effective set.
+func hasEffectiveCapability(capability int) bool {
+	data, err := getCapabilities()
+	if err != nil {
+		return false
+	}
+
+	return data[capability/32].Effective&(1<<(capability%32)) != 0
+}
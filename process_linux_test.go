@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCmd_ProcessSetupDoesNotChangeEnvdir(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	expectedOutput := fmt.Sprintf("Umask:\t%04o\n%d\n", umask, currentNice())
+
+	oldOOMScoreAdj, _ := os.ReadFile("/proc/self/oom_score_adj")
+
+	var oldNofile, oldCore syscall.Rlimit
+	_ = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &oldNofile)
+	_ = syscall.Getrlimit(syscall.RLIMIT_CORE, &oldCore)
+
+	os.Args = []string{
+		"envdir", "-d", t.TempDir(), "--umask", "0077", "--nice", "5", "--oom-score-adj", "100",
+		"--limit-nofile", "512:", "--limit-core", "0:", "true",
+	}
+
+	cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+	if exitCode := cmd.Execute(); exitCode != 0 {
+		t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+	}
+
+	if oomScoreAdj, _ := os.ReadFile("/proc/self/oom_score_adj"); string(oomScoreAdj) != string(oldOOMScoreAdj) {
+		t.Errorf("expected envdir OOM score adjustment to stay %q, got %q", oldOOMScoreAdj, oomScoreAdj)
+	}
+
+	var nofile, core syscall.Rlimit
+	if _ = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &nofile); nofile != oldNofile {
+		t.Errorf("expected envdir nofile limit to stay %v, got %v", oldNofile, nofile)
+	}
+
+	if _ = syscall.Getrlimit(syscall.RLIMIT_CORE, &core); core != oldCore {
+		t.Errorf("expected envdir core limit to stay %v, got %v", oldCore, core)
+	}
+
+	os.Args = []string{"envdir", "-d", t.TempDir(), "sh", "-c", "grep Umask: /proc/$$/status; cut -d ' ' -f 19 /proc/$$/stat"}
+
+	cmd = NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+	if exitCode := cmd.Execute(); exitCode != 0 || cmdStdout.String() != expectedOutput {
+		t.Errorf("expected umask and nice level not to leak to next command (%q), got %d:\n%s", expectedOutput, exitCode, cmdStdout.String())
+	}
+}
+
+func currentNice() int {
+	// raw getpriority syscall returns 20 - nice, to avoid negative values
+	priority, _ := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+
+	return 20 - priority
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startProcess(cmd *exec.Cmd, setup *ProcessSetup) error {
+	if !setup.empty() {
+		return errors.New("process setup is not supported on this platform")
+	}
+
+	return cmd.Start()
+}
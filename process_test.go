@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCmd_ProcessSetup(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var tests = []struct {
+		name           string
+		args           []string
+		script         string
+		expectedOutput string
+	}{
+		{"it runs command in directory", []string{"--chdir", "/proc"}, "readlink /proc/$$/cwd", "/proc\n"},
+		{"it runs command with umask", []string{"--umask", "0027"}, "grep Umask: /proc/$$/status", "Umask:\t0027\n"},
+		{"it runs command with argv0", []string{"--argv0", "custom-sh"}, "tr '\\0' ' ' < /proc/$$/cmdline", "custom-sh -c"},
+		{"it runs command with nice level", []string{"--nice", "7"}, "cut -d ' ' -f 19 /proc/$$/stat", "7\n"},
+		{"it runs command with OOM score adjustment", []string{"--oom-score-adj", "500"}, "cat /proc/$$/oom_score_adj", "500\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+			if runtime.GOOS != "linux" {
+				t.Skip("process setup is supported on linux only")
+			}
+
+			os.Args = append(append([]string{"envdir", "-d", t.TempDir()}, tt.args...), "sh", "-c", tt.script)
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 0 {
+				t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+			}
+
+			if !strings.HasPrefix(cmdStdout.String(), tt.expectedOutput) {
+				t.Errorf("expected output to start with %q, got:\n%s", tt.expectedOutput, cmdStdout.String())
+			}
+		})
+	}
+
+	t.Run("it fails on invalid process options", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--umask", "0888"},
+			{"--umask", "-1"},
+			{"--nice", "20"},
+			{"--nice", "high"},
+			{"--oom-score-adj", "-1001"},
+		} {
+			var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+			os.Args = append(append([]string{"envdir", "-d", t.TempDir()}, args...), "true")
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 2 {
+				t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+			}
+		}
+	})
+
+	t.Run("it refuses to run command in missing directory", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--chdir", filepath.Join(t.TempDir(), "missing"), "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStdout.String(), "changing directory") {
+			t.Errorf("expected error about changing directory, got:\n%s", cmdStdout.String())
+		}
+	})
+}
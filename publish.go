@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	dataDirLink    = "..data"
+	dataDirTmpLink = "..data_tmp"
+)
+
+// dataDirRegex matches names of data directories created by writeDataDir (timestamp and os.MkdirTemp random suffix).
+var dataDirRegex = regexp.MustCompile(`^\.\.\d{4}_\d{2}_\d{2}_\d{2}_\d{2}_\d{2}\.\d+$`)
+
+// publishEnvVars writes a full variable set the same way kubelet AtomicWriter does: files are written to a new
+// timestamped directory, `..data` symlink is atomically swapped to point to it, and every variable is exposed as
+// a `NAME -> ..data/NAME` symlink. Variables missing from the new set and the previous data directory are removed.
+func publishEnvVars(dir string, envVars []EnvVar, mode os.FileMode, logger *Logger) error {
+	for _, envVar := range envVars {
+		if err := validateEnvName(envVar.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating env directory: %w", err)
+	}
+
+	return publishDataFiles(dir, envDataFiles(envVars, mode), logger)
+}
+
+// dataFile is a single file of a published data directory.
+type dataFile struct {
+	Name string
+	Data []byte
+	Mode os.FileMode
+}
+
+// envDataFiles returns a file for every variable, with only the last value kept for names given more than once, as
+// `@import` does.
+func envDataFiles(envVars []EnvVar, mode os.FileMode) []dataFile {
+	dataFiles := make([]dataFile, 0, len(envVars))
+
+	for i, envVar := range envVars {
+		if slices.ContainsFunc(envVars[i+1:], func(later EnvVar) bool { return later.Name == envVar.Name }) {
+			continue
+		}
+
+		dataFiles = append(dataFiles, dataFile{Name: envVar.Name, Data: encodeEnvValue(envVar.Value), Mode: mode})
+	}
+
+	return dataFiles
+}
+
+// isDataDirLayout reports whether dir uses the kubelet AtomicWriter layout, so it must never be written to in place.
+func isDataDirLayout(dir string) bool {
+	info, err := os.Lstat(filepath.Join(dir, dataDirLink))
+
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// updateDataDir publishes a new snapshot made of the current one, with written files replaced and removed names left
+// out. Files which are not changed keep their contents and permissions.
+func updateDataDir(dir string, written []dataFile, removed []string, logger *Logger) error {
+	envPaths, err := listEnvFiles(dir)
+	if err != nil {
+		return fmt.Errorf("reading data directory: %w", err)
+	}
+
+	dataFiles := make([]dataFile, 0, len(envPaths)+len(written))
+	found := make(map[string]bool, len(removed))
+
+	for _, envPath := range envPaths {
+		name := filepath.Base(envPath)
+
+		if slices.Contains(removed, name) {
+			found[name] = true
+
+			continue
+		}
+
+		if slices.ContainsFunc(written, func(writtenFile dataFile) bool { return writtenFile.Name == name }) {
+			continue
+		}
+
+		info, err := os.Stat(envPath)
+		if err != nil {
+			return fmt.Errorf("reading data directory: %w", err)
+		}
+
+		data, err := os.ReadFile(envPath)
+		if err != nil {
+			return fmt.Errorf("reading data directory: %w", err)
+		}
+
+		dataFiles = append(dataFiles, dataFile{Name: name, Data: data, Mode: info.Mode().Perm()})
+	}
+
+	for _, name := range removed {
+		if !found[name] {
+			logger.Info("variable is not set", LogFields{"name": name, "dir": dir})
+		}
+	}
+
+	if len(written) == 0 && len(found) == 0 {
+		return nil
+	}
+
+	return publishDataFiles(dir, append(dataFiles, written...), logger)
+}
+
+// writeDirFile writes file at path atomically, unless path is in the current snapshot of a published directory, which
+// must never be written to in place, so a new snapshot with the file is published instead.
+func writeDirFile(dir, path string, data []byte, perm os.FileMode, logger *Logger) error {
+	if isDataDirLayout(dir) && filepath.Dir(path) == resolveEnvDir(dir) {
+		return updateDataDir(dir, []dataFile{{Name: filepath.Base(path), Data: data, Mode: perm}}, nil, logger)
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+func publishDataFiles(dir string, dataFiles []dataFile, logger *Logger) error {
+	oldDataDir, _ := os.Readlink(filepath.Join(dir, dataDirLink))
+
+	newDataDir, err := writeDataDir(dir, dataFiles)
+	if err != nil {
+		return err
+	}
+
+	if err := swapSymlink(filepath.Join(dir, dataDirLink), filepath.Base(newDataDir)); err != nil {
+		os.RemoveAll(newDataDir)
+
+		return err
+	}
+
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	logger.Info("published variables", LogFields{"dir": dir, "data": filepath.Base(newDataDir), "count": len(dataFiles)})
+
+	if err := updateVisibleSymlinks(dir, dataFiles, logger); err != nil {
+		return err
+	}
+
+	// only remove directories created by a previous publish, never whatever else `..data` might point to
+	if dataDirRegex.MatchString(oldDataDir) {
+		if err := os.RemoveAll(filepath.Join(dir, oldDataDir)); err != nil {
+			return fmt.Errorf("removing previous data directory: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func writeDataDir(dir string, dataFiles []dataFile) (string, error) {
+	dataDir, err := os.MkdirTemp(dir, time.Now().UTC().Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		return "", fmt.Errorf("creating data directory: %w", err)
+	}
+
+	if err := os.Chmod(dataDir, 0755); err != nil {
+		os.RemoveAll(dataDir)
+
+		return "", fmt.Errorf("setting permissions of data directory: %w", err)
+	}
+
+	for _, dataFile := range dataFiles {
+		envPath := filepath.Join(dataDir, dataFile.Name)
+
+		if err := writeFileSync(envPath, dataFile.Data, dataFile.Mode); err != nil {
+			os.RemoveAll(dataDir)
+
+			return "", fmt.Errorf("writing env file `%s`: %w", envPath, err)
+		}
+	}
+
+	// files and their directory entries must be on disk before `..data` points to them
+	if err := syncDir(dataDir); err != nil {
+		os.RemoveAll(dataDir)
+
+		return "", err
+	}
+
+	return dataDir, nil
+}
+
+func writeFileSync(path string, data []byte, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening directory `%s`: %w", dir, err)
+	}
+	defer dirFile.Close()
+
+	if err := dirFile.Sync(); err != nil {
+		return fmt.Errorf("syncing directory `%s`: %w", dir, err)
+	}
+
+	return nil
+}
+
+func swapSymlink(linkPath, target string) error {
+	tmpLinkPath := filepath.Join(filepath.Dir(linkPath), dataDirTmpLink)
+
+	if err := os.Remove(tmpLinkPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing stale symlink `%s`: %w", tmpLinkPath, err)
+	}
+
+	if err := os.Symlink(target, tmpLinkPath); err != nil {
+		return fmt.Errorf("creating symlink `%s`: %w", tmpLinkPath, err)
+	}
+
+	if err := os.Rename(tmpLinkPath, linkPath); err != nil {
+		os.Remove(tmpLinkPath)
+
+		return fmt.Errorf("replacing symlink `%s`: %w", linkPath, err)
+	}
+
+	return nil
+}
+
+func updateVisibleSymlinks(dir string, dataFiles []dataFile, logger *Logger) error {
+	published := make(map[string]bool, len(dataFiles))
+
+	for _, dataFile := range dataFiles {
+		published[dataFile.Name] = true
+		target := filepath.Join(dataDirLink, dataFile.Name)
+
+		if currentTarget, err := os.Readlink(filepath.Join(dir, dataFile.Name)); err == nil && currentTarget == target {
+			continue
+		}
+
+		if err := swapSymlink(filepath.Join(dir, dataFile.Name), target); err != nil {
+			return err
+		}
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading env directory: %w", err)
+	}
+
+	for _, dirEntry := range dirEntries {
+		envPath := filepath.Join(dir, dirEntry.Name())
+		target, err := os.Readlink(envPath)
+
+		if err != nil || published[dirEntry.Name()] || target != filepath.Join(dataDirLink, dirEntry.Name()) {
+			continue
+		}
+
+		if err := os.Remove(envPath); err != nil {
+			return fmt.Errorf("removing stale symlink `%s`: %w", envPath, err)
+		}
+
+		logger.Info("removed variable from directory", LogFields{"name": dirEntry.Name(), "dir": dir})
+	}
+
+	return nil
+}
+
+// Publish atomically replaces the whole variable set in an env directory, using the kubelet AtomicWriter layout.
+func (c Cmd) Publish(args []string) int {
+	var dir, format string
+
+	mode := fileModeValue(0600)
+	flagSet := c.newSubcommandFlagSet("publish")
+	c.dirFlag(flagSet, &dir)
+	flagSet.Var(&mode, "m", "Permissions of written files (octal)")
+	flagSet.StringVar(&format, "format", "", "Input format (dotenv/json/env), detected from file extension by default")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if flagSet.NArg() > 1 || (format == "env" && flagSet.NArg() > 0) {
+		logger.Error("publish accepts at most one input file", LogFields{"args": flagSet.Args()})
+
+		return 2
+	}
+
+	envVars, err := c.importEnvVars(flagSet.Arg(0), format)
+	if errors.Is(err, errInvalidImportFormat) {
+		logger.Error("invalid import format", LogFields{"format": format})
+
+		return 2
+	}
+
+	if err != nil {
+		logger.Error("error reading variables to publish", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	if err := publishEnvVars(dir, envVars, os.FileMode(mode), logger); err != nil {
+		logger.Error("error publishing variables to directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	return 0
+}
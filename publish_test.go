@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmd_Publish(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envDir := t.TempDir()
+
+	publish := func(input string) {
+		t.Helper()
+
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@publish", "-d", envDir}
+
+		cmd := NewCmd(strings.NewReader(input), &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+	}
+
+	t.Run("it publishes variables using atomic writer layout", func(t *testing.T) {
+		publish("LOREM=ipsum\nDOLOR=sit\n")
+
+		dataDir, err := os.Readlink(filepath.Join(envDir, dataDirLink))
+		if err != nil || !strings.HasPrefix(dataDir, "..") {
+			t.Fatalf("expected ..data symlink to timestamped directory, got %q (%v)", dataDir, err)
+		}
+
+		for _, envName := range []string{"LOREM", "DOLOR"} {
+			if target, err := os.Readlink(filepath.Join(envDir, envName)); err != nil || target != filepath.Join(dataDirLink, envName) {
+				t.Errorf("expected %s symlink to ..data, got %q (%v)", envName, target, err)
+			}
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "LOREM"), "ipsum", 0600)
+	})
+
+	t.Run("it replaces previous variable set", func(t *testing.T) {
+		oldDataDir, _ := os.Readlink(filepath.Join(envDir, dataDirLink))
+
+		publish("LOREM=changed\nAMET=new\n")
+
+		if _, err := os.Lstat(filepath.Join(envDir, oldDataDir)); !os.IsNotExist(err) {
+			t.Errorf("expected previous data directory to be removed, got %v", err)
+		}
+
+		if _, err := os.Lstat(filepath.Join(envDir, "DOLOR")); !os.IsNotExist(err) {
+			t.Errorf("expected removed variable symlink to be deleted, got %v", err)
+		}
+
+		envFiles, err := readEnvDir(envDir)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		envs := make([]string, 0)
+		for _, envFile := range envFiles {
+			envs = append(envs, envFile.Name+"="+envFile.Value())
+		}
+
+		if strings.Join(envs, ",") != "AMET=new,LOREM=changed" {
+			t.Errorf("expected only published variables to be read, got %v", envs)
+		}
+	})
+
+	t.Run("it keeps previous data directory not created by publish", func(t *testing.T) {
+		for _, oldDataDir := range []string{"..", "..custom"} {
+			var cmdStdout, cmdStderr bytes.Buffer
+
+			rootDir := t.TempDir()
+			envDir := filepath.Join(rootDir, "env")
+
+			if err := os.MkdirAll(filepath.Join(envDir, "..custom"), 0755); err != nil {
+				t.Fatalf("error creating env dir: %v", err)
+			}
+
+			if err := os.Symlink(oldDataDir, filepath.Join(envDir, dataDirLink)); err != nil {
+				t.Fatalf("error creating ..data symlink: %v", err)
+			}
+
+			os.Args = []string{"envdir", "@publish", "-d", envDir}
+
+			cmd := NewCmd(strings.NewReader("LOREM=ipsum\n"), &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 0 {
+				t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+			}
+
+			if _, err := os.Stat(filepath.Join(envDir, oldDataDir)); err != nil {
+				t.Errorf("expected %q to be kept, got %v", oldDataDir, err)
+			}
+		}
+	})
+}
+
+func TestCmd_WritePublishedDir(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envDir := t.TempDir()
+
+	run := func(input string, args ...string) {
+		t.Helper()
+
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = append([]string{"envdir", args[0], "-d", envDir}, args[1:]...)
+
+		cmd := NewCmd(strings.NewReader(input), &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code for %v, got %d:\n%s", args, exitCode, cmdStderr.String())
+		}
+	}
+
+	run("LOREM=ipsum\nDOLOR=sit\n", "@publish")
+	oldDataDir, _ := os.Readlink(filepath.Join(envDir, dataDirLink))
+
+	run("", "@set", "LOREM", "changed")
+	run("", "@set", "-m", "0640", "NEW", "value")
+	run("AMET=imported\n", "@import")
+	run("", "@unset", "DOLOR", "MISSING")
+
+	if dataDir, _ := os.Readlink(filepath.Join(envDir, dataDirLink)); dataDir == oldDataDir || !dataDirRegex.MatchString(dataDir) {
+		t.Errorf("expected new data directory to be published, got %q", dataDir)
+	}
+
+	for _, envName := range []string{"LOREM", "NEW", "AMET"} {
+		if target, err := os.Readlink(filepath.Join(envDir, envName)); err != nil || target != filepath.Join(dataDirLink, envName) {
+			t.Errorf("expected %s symlink to ..data, got %q (%v)", envName, target, err)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(envDir, "DOLOR")); !os.IsNotExist(err) {
+		t.Errorf("expected unset variable symlink to be deleted, got %v", err)
+	}
+
+	envFiles, err := readEnvDir(envDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	envs := make([]string, 0)
+	for _, envFile := range envFiles {
+		envs = append(envs, envFile.Name+"="+envFile.Value())
+	}
+
+	if strings.Join(envs, ",") != "AMET=imported,LOREM=changed,NEW=value" {
+		t.Errorf("expected updated variables to be read, got %v", envs)
+	}
+
+	assertEnvFile(t, filepath.Join(envDir, "NEW"), "value", 0640)
+}
+
+func TestCmd_RewritePublishedDir(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envDir := t.TempDir()
+	keyPath := filepath.Join(t.TempDir(), "key")
+
+	run := func(input string, args ...string) string {
+		t.Helper()
+
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = append([]string{"envdir"}, args...)
+
+		cmd := NewCmd(strings.NewReader(input), &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code for %v, got %d:\n%s%s", args, exitCode, cmdStdout.String(), cmdStderr.String())
+		}
+
+		return cmdStdout.String()
+	}
+
+	published := func() string {
+		t.Helper()
+
+		dataDir, _ := os.Readlink(filepath.Join(envDir, dataDirLink))
+
+		return dataDir
+	}
+
+	publicKey := strings.TrimSpace(run("", "@keygen", "-o", keyPath))
+	run("LOREM=first\nDOLOR=sit\nLOREM=ipsum\n", "@publish", "-d", envDir)
+
+	// a file broken by whoever else writes the snapshot, for lint to fix
+	if err := os.WriteFile(filepath.Join(envDir, dataDirLink, "DOLOR"), []byte("sit\r\n"), 0600); err != nil {
+		t.Fatalf("error writing env file: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"@lint", "-fix", envDir},
+		{"@manifest", "generate", "-d", envDir, "-o", "SHA256SUMS"},
+		{"@sign", "-d", envDir, "-k", keyPath},
+	} {
+		dataDir := published()
+		run("", args...)
+
+		if newDataDir := published(); newDataDir == dataDir || !dataDirRegex.MatchString(newDataDir) {
+			t.Errorf("expected new data directory to be published by %v, got %q", args, newDataDir)
+		}
+	}
+
+	for _, name := range []string{"SHA256SUMS", "SHA256SUMS.sig"} {
+		if target, err := os.Readlink(filepath.Join(envDir, name)); err != nil || target != filepath.Join(dataDirLink, name) {
+			t.Errorf("expected %s symlink to ..data, got %q (%v)", name, target, err)
+		}
+	}
+
+	if output := run("", "-d", envDir, "--manifest-pubkey", publicKey, "sh", "-c", `echo "$LOREM $DOLOR"`); output != "ipsum sit\n" {
+		t.Errorf("expected signed variables from published directory, got %q", output)
+	}
+}
+
+func Test_ReadEnvDirAtomicWriterLayout(t *testing.T) {
+	envDir := t.TempDir()
+	dataDir := filepath.Join(envDir, "..2024_01_01_00_00_00.123")
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatalf("error creating data dir: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, "LOREM"), []byte("ipsum"), 0600); err != nil {
+		t.Fatalf("error creating env file: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Base(dataDir), filepath.Join(envDir, dataDirLink)); err != nil {
+		t.Fatalf("error creating ..data symlink: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(envDir, "STALE"), []byte("outside of snapshot"), 0600); err != nil {
+		t.Fatalf("error creating env file: %v", err)
+	}
+
+	envFiles, err := readEnvDir(envDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(envFiles) != 1 || envFiles[0].Name != "LOREM" || envFiles[0].Value() != "ipsum" {
+		t.Errorf("expected variables to be read only from ..data, got %v", envFiles)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const rlimitUnlimited = math.MaxUint64
+
+// rlimitNames lists supported resource limits, as used in `--limit-NAME` flags.
+var rlimitNames = []string{"nofile", "nproc", "as", "data", "core", "stack", "cpu"}
+
+var rlimitSuffixes = map[string]uint64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+// Rlimit is a resource limit requested for the subprocess. Missing soft or hard value is left unchanged.
+type Rlimit struct {
+	Soft    uint64
+	Hard    uint64
+	HasSoft bool
+	HasHard bool
+}
+
+func formatRlimitValue(value uint64) string {
+	if value == rlimitUnlimited {
+		return "unlimited"
+	}
+
+	return strconv.FormatUint(value, 10)
+}
+
+func (r Rlimit) String() string {
+	var soft, hard string
+
+	if r.HasSoft {
+		soft = formatRlimitValue(r.Soft)
+	}
+
+	if r.HasHard {
+		hard = formatRlimitValue(r.Hard)
+	}
+
+	if soft == hard {
+		return soft
+	}
+
+	return soft + ":" + hard
+}
+
+func parseRlimitValue(value string) (uint64, error) {
+	if value == "unlimited" || value == "infinity" {
+		return rlimitUnlimited, nil
+	}
+
+	multiplier := uint64(1)
+	if suffixMultiplier, ok := rlimitSuffixes[strings.ToUpper(value[len(value)-1:])]; ok {
+		multiplier = suffixMultiplier
+		value = value[:len(value)-1]
+	}
+
+	parsedValue, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || parsedValue > rlimitUnlimited/multiplier {
+		return 0, fmt.Errorf("invalid limit value %q", value)
+	}
+
+	return parsedValue * multiplier, nil
+}
+
+// parseRlimit parses `soft:hard`, `soft:`, `:hard` or a single value used for both soft and hard limit, the same
+// way prlimit(1) does. Values are numbers with optional K/M/G/T suffix, or `unlimited`.
+func parseRlimit(value string) (Rlimit, error) {
+	var (
+		rlimit Rlimit
+		err    error
+	)
+
+	soft, hard, hasSeparator := strings.Cut(value, ":")
+	if !hasSeparator {
+		hard = soft
+	}
+
+	if soft != "" {
+		if rlimit.Soft, err = parseRlimitValue(soft); err != nil {
+			return Rlimit{}, err
+		}
+
+		rlimit.HasSoft = true
+	}
+
+	if hard != "" {
+		if rlimit.Hard, err = parseRlimitValue(hard); err != nil {
+			return Rlimit{}, err
+		}
+
+		rlimit.HasHard = true
+	}
+
+	if !rlimit.HasSoft && !rlimit.HasHard {
+		return Rlimit{}, fmt.Errorf("empty limit value %q", value)
+	}
+
+	if rlimit.HasSoft && rlimit.HasHard && rlimit.Soft > rlimit.Hard {
+		return Rlimit{}, fmt.Errorf("soft limit is greater than hard limit in %q", value)
+	}
+
+	return rlimit, nil
+}
+
+type rlimitValue struct {
+	limits map[string]Rlimit
+	name   string
+}
+
+func (rv *rlimitValue) Set(value string) error {
+	rlimit, err := parseRlimit(value)
+	if err != nil {
+		return err
+	}
+
+	rv.limits[rv.name] = rlimit
+
+	return nil
+}
+
+func (rv *rlimitValue) String() string {
+	if rv.limits == nil {
+		return ""
+	}
+
+	return rv.limits[rv.name].String()
+}
+
+func (rv *rlimitValue) Get() any {
+	return rv.String()
+}
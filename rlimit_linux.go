@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"nofile": unix.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+	"as":     unix.RLIMIT_AS,
+	"data":   unix.RLIMIT_DATA,
+	"core":   unix.RLIMIT_CORE,
+	"stack":  unix.RLIMIT_STACK,
+	"cpu":    unix.RLIMIT_CPU,
+}
+
+// resolveRlimit merges requested limit with the current one, and validates the result. Hard limit can be raised
+// above the current one only with CAP_SYS_RESOURCE. The current limit is returned too.
+func resolveRlimit(name string, rlimit Rlimit) (unix.Rlimit, unix.Rlimit, error) {
+	var current unix.Rlimit
+	if err := unix.Getrlimit(rlimitResources[name], &current); err != nil {
+		return unix.Rlimit{}, current, fmt.Errorf("reading current %s limit: %w", name, err)
+	}
+
+	resolved := current
+	if rlimit.HasHard {
+		resolved.Max = rlimit.Hard
+	}
+
+	if rlimit.HasSoft {
+		resolved.Cur = rlimit.Soft
+	} else if resolved.Cur > resolved.Max {
+		resolved.Cur = resolved.Max
+	}
+
+	if resolved.Cur > resolved.Max {
+		return unix.Rlimit{}, current, fmt.Errorf(
+			"soft %s limit %s is greater than hard limit %s", name, formatRlimitValue(resolved.Cur), formatRlimitValue(resolved.Max),
+		)
+	}
+
+	if resolved.Max > current.Max && !hasEffectiveCapability(unix.CAP_SYS_RESOURCE) {
+		return unix.Rlimit{}, current, fmt.Errorf(
+			"hard %s limit %s is greater than current hard limit %s", name, formatRlimitValue(resolved.Max), formatRlimitValue(current.Max),
+		)
+	}
+
+	return resolved, current, nil
+}
+
+// rlimitExecArg marks envdir started again as the subprocess, only to set resource limits and execute the command.
+const rlimitExecArg = "@@rlimit-exec"
+
+// init runs envdir started with rlimitExecArg as the limits trampoline, before anything else, also in test binaries.
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == rlimitExecArg {
+		os.Exit(execWithRlimits(os.Args[2:]))
+	}
+}
+
+// execWithRlimits sets limits given as `NAME=soft:hard` arguments, followed by `--`, path and arguments of the command,
+// and executes it in place. Nothing but exec happens after limits are set, so the Go runtime is never starved by them.
+func execWithRlimits(args []string) int {
+	logger := NewLogger(&Flags{LogFormat: "text", LogLevel: "warn"}, os.Stderr)
+
+	separator := slices.Index(args, "--")
+	if separator < 0 || len(args) < separator+3 {
+		logger.Error("invalid arguments of resource limits trampoline", LogFields{"args": args})
+
+		return 1
+	}
+
+	limits := make(map[int]syscall.Rlimit, separator)
+
+	for _, arg := range args[:separator] {
+		name, value, _ := strings.Cut(arg, "=")
+
+		resource, ok := rlimitResources[name]
+		rlimit, err := parseRlimit(value)
+
+		if !ok || err != nil || !rlimit.HasSoft || !rlimit.HasHard {
+			logger.Error("invalid resource limit", LogFields{"limit": arg})
+
+			return 1
+		}
+
+		limits[resource] = syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}
+	}
+
+	path, argv, env := args[separator+1], args[separator+2:], os.Environ()
+
+	// the thread is never unlocked, as nothing else is meant to run until exec
+	runtime.LockOSThread()
+
+	for resource, limit := range limits {
+		if err := syscall.Setrlimit(resource, &limit); err != nil {
+			logger.Error("error setting resource limit", LogFields{"resource": resource, "err": err.Error()})
+
+			return 1
+		}
+	}
+
+	err := syscall.Exec(path, argv, env)
+	logger.Error("error running subprocess", LogFields{"path": path, "err": err.Error()})
+
+	return 1
+}
+
+// setupRlimits makes the subprocess start as envdir itself, which sets the limits and only then executes the command,
+// so they apply from its very first instruction (including exec of setuid binaries and switching user), while envdir
+// limits stay untouched. Hard limits above the current ones are raised in envdir right before the subprocess is
+// forked, as privileges needed for that may be dropped by then, and lowered back once it has been started.
+func setupRlimits(cmd *exec.Cmd, setup *ProcessSetup, limits map[string]Rlimit, logger *Logger) error {
+	execArgs := []string{cmd.Args[0], rlimitExecArg}
+	raisedLimits := make(map[string]unix.Rlimit)
+
+	for _, name := range rlimitNames {
+		rlimit, ok := limits[name]
+		if !ok {
+			continue
+		}
+
+		resolved, current, err := resolveRlimit(name, rlimit)
+		if err != nil {
+			return err
+		}
+
+		if resolved.Max > current.Max {
+			raisedLimits[name] = unix.Rlimit{Cur: current.Cur, Max: resolved.Max}
+		}
+
+		logger.Info("applying resource limit", LogFields{
+			"name": name, "soft": formatRlimitValue(resolved.Cur), "hard": formatRlimitValue(resolved.Max),
+		})
+
+		execArgs = append(execArgs, name+"="+formatRlimitValue(resolved.Cur)+":"+formatRlimitValue(resolved.Max))
+	}
+
+	// argv0 is already set, and is passed on together with the command path
+	cmd.Args = append(append(execArgs, "--", cmd.Path), cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+
+	if len(raisedLimits) == 0 {
+		return nil
+	}
+
+	setup.OnFork(func() (func(), error) {
+		previousLimits := make(map[string]unix.Rlimit, len(raisedLimits))
+		revert := func() {
+			for name, previous := range previousLimits {
+				_ = unix.Prlimit(0, rlimitResources[name], &previous, nil)
+			}
+		}
+
+		for name, raised := range raisedLimits {
+			var previous unix.Rlimit
+			if err := unix.Prlimit(0, rlimitResources[name], &raised, &previous); err != nil {
+				revert()
+
+				return nil, fmt.Errorf("raising %s hard limit: %w", name, err)
+			}
+
+			previousLimits[name] = previous
+		}
+
+		return revert, nil
+	})
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+func setupRlimits(_ *exec.Cmd, _ *ProcessSetup, _ map[string]Rlimit, _ *Logger) error {
+	return errProcessSetupNotSupported
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_ParseRlimit(t *testing.T) {
+	var tests = []struct {
+		value          string
+		expectedRlimit Rlimit
+	}{
+		{"1024", Rlimit{Soft: 1024, Hard: 1024, HasSoft: true, HasHard: true}},
+		{"512:1024", Rlimit{Soft: 512, Hard: 1024, HasSoft: true, HasHard: true}},
+		{"512:", Rlimit{Soft: 512, HasSoft: true}},
+		{":1024", Rlimit{Hard: 1024, HasHard: true}},
+		{"1M:unlimited", Rlimit{Soft: 1 << 20, Hard: rlimitUnlimited, HasSoft: true, HasHard: true}},
+		{"2k:infinity", Rlimit{Soft: 2 << 10, Hard: rlimitUnlimited, HasSoft: true, HasHard: true}},
+	}
+
+	for _, tt := range tests {
+		rlimit, err := parseRlimit(tt.value)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.value, err)
+
+			continue
+		}
+
+		if rlimit != tt.expectedRlimit {
+			t.Errorf("invalid limit for %q: expected %+v, got %+v", tt.value, tt.expectedRlimit, rlimit)
+		}
+	}
+
+	for _, value := range []string{"", ":", "many", "-1", "1024:512", "1X", "K", "18446744073709551615T"} {
+		if _, err := parseRlimit(value); err == nil {
+			t.Errorf("expected error for %q, got none", value)
+		}
+	}
+}
+
+func TestCmd_Limits(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it applies resource limits to command", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are supported on linux only")
+		}
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--limit-nofile", "512:1024", "--limit-core=0", "sh", "-c", "ulimit -Sn; ulimit -Hn; ulimit -Sc"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "512\n1024\n0\n") {
+			t.Errorf("expected limits to be applied to command, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it applies resource limits from environment", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are supported on linux only")
+		}
+
+		t.Setenv("ENVDIR_LIMIT_NOFILE", "256:")
+		os.Args = []string{"envdir", "-d", t.TempDir(), "sh", "-c", "ulimit -Sn"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "256\n") {
+			t.Errorf("expected limit to be applied to command, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it applies memory limits without constraining envdir", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are supported on linux only")
+		}
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--limit-as", "256M", "--limit-data", "10M", "sh", "-c", "ulimit -v; ulimit -d"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "262144\n10240\n") {
+			t.Errorf("expected limits to be applied to command, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it applies process limit without constraining envdir", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are supported on linux only")
+		}
+
+		if os.Geteuid() != 0 {
+			t.Skip("switching user requires root")
+		}
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--user", "65534", "--limit-nproc", "3", "grep", "processes", "/proc/self/limits"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if fields := strings.Fields(cmdStdout.String()); len(fields) < 4 || fields[2] != "3" || fields[3] != "3" {
+			t.Errorf("expected limit to be applied to command, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails on invalid resource limits", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--limit-nofile", "1024:512", "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// manifestPublicKey can be embedded at build time with `-ldflags "-X main.manifestPublicKey=KEY"`, so every
+// directory has to be signed with the matching private key.
+var manifestPublicKey = ""
+
+const (
+	defaultManifestName = "SHA256SUMS"
+	signatureSuffix     = ".sig"
+)
+
+func decodeKey(encodedKey string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("expected base64 encoded %d bytes key", size)
+	}
+
+	return key, nil
+}
+
+func parsePublicKey(encodedKey string) (ed25519.PublicKey, error) {
+	key, err := decodeKey(encodedKey, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	return key, nil
+}
+
+// loadPrivateKey reads private key file written by `envdir @keygen`, which holds the key seed.
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %w", err)
+	}
+
+	seed, err := decodeKey(string(data), ed25519.SeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// verifySignature checks detached signature of data, stored next to it with .sig suffix.
+func verifySignature(publicKey ed25519.PublicKey, data []byte, path string) error {
+	encodedSignature, err := os.ReadFile(path + signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil || !ed25519.Verify(publicKey, data, signature) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+type publicKeyValue struct {
+	target *string
+}
+
+func (p *publicKeyValue) Set(value string) error {
+	if _, err := parsePublicKey(value); err != nil {
+		return err
+	}
+
+	*p.target = value
+
+	return nil
+}
+
+func (p *publicKeyValue) String() string {
+	if p.target == nil {
+		return ""
+	}
+
+	return *p.target
+}
+
+func (p *publicKeyValue) Get() any {
+	return *p.target
+}
+
+// PublicKey returns key used to verify manifest signature, taken from flag, file or embedded at build time, in that
+// order. Signature verification is disabled, if there is none.
+func (f *Flags) PublicKey() (ed25519.PublicKey, error) {
+	switch {
+	case f.ManifestPubkey != "":
+		return parsePublicKey(f.ManifestPubkey)
+	case f.ManifestPubkeyFile != "":
+		data, err := os.ReadFile(f.ManifestPubkeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading public key: %w", err)
+		}
+
+		return parsePublicKey(string(data))
+	case manifestPublicKey != "":
+		return parsePublicKey(manifestPublicKey)
+	default:
+		return nil, nil
+	}
+}
+
+// Keygen generates Ed25519 key pair for signing manifests. Private key is written to a new file, public key is
+// printed, to be passed with `--manifest-pubkey`.
+func (c Cmd) Keygen(args []string) int {
+	var output string
+
+	flagSet := c.newSubcommandFlagSet("keygen")
+	flagSet.StringVar(&output, "o", "", "Write private key to file")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if output == "" {
+		logger.Error("keygen requires private key file", LogFields{})
+
+		return 2
+	}
+
+	if _, err := os.Lstat(output); err == nil {
+		logger.Error("refusing to overwrite existing private key", LogFields{"path": output})
+
+		return 1
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		logger.Error("error generating key", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	encodedSeed := base64.StdEncoding.EncodeToString(privateKey.Seed()) + "\n"
+	if err := writeFileAtomic(output, []byte(encodedSeed), 0600); err != nil {
+		logger.Error("error writing private key", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	_, _ = c.Stdout.Write([]byte(base64.StdEncoding.EncodeToString(publicKey) + "\n"))
+
+	return 0
+}
+
+// Sign writes detached signature of the directory manifest, next to it.
+func (c Cmd) Sign(args []string) int {
+	var dir, keyPath, manifest string
+
+	flagSet := c.newSubcommandFlagSet("sign")
+	c.dirFlag(flagSet, &dir)
+	flagSet.StringVar(&keyPath, "k", "", "Private key file")
+	flagSet.StringVar(&manifest, "m", defaultManifestName, "Manifest to sign, relative to directory")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if keyPath == "" {
+		logger.Error("sign requires private key file", LogFields{})
+
+		return 2
+	}
+
+	privateKey, err := loadPrivateKey(keyPath)
+	if err != nil {
+		logger.Error("error loading private key", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	path := manifestPath(dir, manifest)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("error reading manifest", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data)) + "\n"
+	if err := writeDirFile(dir, path+signatureSuffix, []byte(signature), 0644, logger); err != nil {
+		logger.Error("error writing signature", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	return 0
+}
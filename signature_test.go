@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmd_Sign(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	keyDir := t.TempDir()
+	keyPath := filepath.Join(keyDir, "key")
+
+	var keygenStdin, keygenStdout, keygenStderr bytes.Buffer
+
+	os.Args = []string{"envdir", "@keygen", "-o", keyPath}
+	if exitCode := NewCmd(&keygenStdin, &keygenStdout, &keygenStderr).Execute(); exitCode != 0 {
+		t.Fatalf("expected success exit code, got %d:\n%s", exitCode, keygenStderr.String())
+	}
+
+	publicKey := strings.TrimSpace(keygenStdout.String())
+	if _, err := parsePublicKey(publicKey); err != nil {
+		t.Fatalf("expected public key to be printed, got %v", err)
+	}
+
+	if fileInfo, err := os.Stat(keyPath); err != nil || fileInfo.Mode().Perm() != 0600 {
+		t.Fatalf("expected private key with 0600 mode, got %v (%v)", fileInfo, err)
+	}
+
+	signedDir := func(t *testing.T) string {
+		t.Helper()
+
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"A": "a\n"})
+
+		os.Args = []string{"envdir", "@manifest", "generate", "-d", dir, "-o", "SHA256SUMS"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		os.Args = []string{"envdir", "@sign", "-d", dir, "-k", keyPath}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		return dir
+	}
+
+	t.Run("it refuses to overwrite private key", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@keygen", "-o", keyPath}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d", exitCode)
+		}
+	})
+
+	t.Run("it runs command with signed directory", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := signedDir(t)
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest-pubkey", publicKey, "sh", "-c", `echo "$A $SHA256SUMS_SIG"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "a \n" {
+			t.Errorf("expected verified variables without manifest and signature, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it reads public key from file", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := signedDir(t)
+		publicKeyPath := filepath.Join(keyDir, "key.pub")
+		if err := os.WriteFile(publicKeyPath, []byte(publicKey+"\n"), 0644); err != nil {
+			t.Fatalf("error writing public key: %v", err)
+		}
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest-pubkey-file", publicKeyPath, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it uses embedded public key", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		oldManifestPublicKey := manifestPublicKey
+		defer func() { manifestPublicKey = oldManifestPublicKey }()
+
+		manifestPublicKey = publicKey
+		dir := writeEnvDir(t, map[string]string{"A": "a\n"})
+
+		os.Args = []string{"envdir", "-d", dir, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected unsigned directory to be refused, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		os.Args = []string{"envdir", "-d", signedDir(t), "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		os.Args = []string{"envdir", "-d", filepath.Join(dir, "missing"), "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected missing directory to be refused, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses to run without directory even without --fail", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", filepath.Join(t.TempDir(), "missing"), "--manifest-pubkey", publicKey, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses to run with tampered manifest", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := signedDir(t)
+		if err := os.WriteFile(filepath.Join(dir, "B"), []byte("b\n"), 0600); err != nil {
+			t.Fatalf("error creating env file: %v", err)
+		}
+
+		os.Args = []string{"envdir", "@manifest", "generate", "-d", dir, "-o", "SHA256SUMS"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Fatalf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest-pubkey", publicKey, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), "invalid signature") {
+			t.Errorf("expected invalid signature in log, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses to run without signature", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := signedDir(t)
+		_ = os.Remove(filepath.Join(dir, "SHA256SUMS.sig"))
+
+		os.Args = []string{"envdir", "-d", dir, "--manifest-pubkey", publicKey, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 4 {
+			t.Errorf("expected manifest verification exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+	})
+
+	t.Run("it rejects invalid public key", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "--manifest-pubkey", "c2hvcnQ=", "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 2 {
+			t.Errorf("expected usage error exit code, got %d", exitCode)
+		}
+	})
+}
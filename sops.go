@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// sopsDefaultUnencryptedSuffix is used by SOPS when metadata holds no rule telling which values are encrypted.
+const sopsDefaultUnencryptedSuffix = "_unencrypted"
+
+var (
+	sopsEncryptedRegex = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]$`)
+	sopsDotenvAgeRegex = regexp.MustCompile(`^sops_age__list_(\d+)__map_enc$`)
+
+	// sopsMACOnlyEncryptedInit starts the MAC hash when only encrypted values are authenticated, so it always differs
+	// from the MAC over all values (copied from SOPS).
+	sopsMACOnlyEncryptedInit = []byte{
+		0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0x0b,
+		0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69,
+	}
+)
+
+type sopsValue struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+type sopsAgeKey struct {
+	Enc string `yaml:"enc"`
+}
+
+type sopsMetadata struct {
+	Age                     []sopsAgeKey `yaml:"age"`
+	LastModified            string       `yaml:"lastmodified"`
+	MAC                     string       `yaml:"mac"`
+	UnencryptedSuffix       string       `yaml:"unencrypted_suffix"`
+	EncryptedSuffix         string       `yaml:"encrypted_suffix"`
+	UnencryptedRegex        string       `yaml:"unencrypted_regex"`
+	EncryptedRegex          string       `yaml:"encrypted_regex"`
+	UnencryptedCommentRegex string       `yaml:"unencrypted_comment_regex"`
+	EncryptedCommentRegex   string       `yaml:"encrypted_comment_regex"`
+	MACOnlyEncrypted        bool         `yaml:"mac_only_encrypted"`
+}
+
+// checkRules validates the rule telling which values are encrypted the same way SOPS does, and falls back to its
+// default one. Comment based rules are refused, as comments are not read.
+func (m *sopsMetadata) checkRules() error {
+	if m.UnencryptedCommentRegex != "" || m.EncryptedCommentRegex != "" {
+		return errors.New("comment based encryption rules are not supported")
+	}
+
+	rules := 0
+
+	for _, rule := range []string{m.UnencryptedSuffix, m.EncryptedSuffix, m.UnencryptedRegex, m.EncryptedRegex} {
+		if rule != "" {
+			rules++
+		}
+	}
+
+	if rules > 1 {
+		return errors.New("more than one encryption rule in sops metadata")
+	}
+
+	if rules == 0 {
+		m.UnencryptedSuffix = sopsDefaultUnencryptedSuffix
+	}
+
+	for _, rule := range []string{m.UnencryptedRegex, m.EncryptedRegex} {
+		if _, err := regexp.Compile(rule); err != nil {
+			return fmt.Errorf("invalid encryption rule in sops metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// shouldBeEncrypted tells whether SOPS encrypts value of a top level key, which is the only kind of values read.
+func (m sopsMetadata) shouldBeEncrypted(name string) bool {
+	switch {
+	case m.UnencryptedSuffix != "":
+		return !strings.HasSuffix(name, m.UnencryptedSuffix)
+	case m.EncryptedSuffix != "":
+		return strings.HasSuffix(name, m.EncryptedSuffix)
+	case m.UnencryptedRegex != "":
+		matched, _ := regexp.MatchString(m.UnencryptedRegex, name)
+
+		return !matched
+	case m.EncryptedRegex != "":
+		matched, _ := regexp.MatchString(m.EncryptedRegex, name)
+
+		return matched
+	default:
+		return true
+	}
+}
+
+// SopsFile holds top level values of SOPS encrypted file in their original order, which the MAC depends on.
+type SopsFile struct {
+	Values   []sopsValue
+	Metadata sopsMetadata
+}
+
+// parseSopsTree reads SOPS encrypted YAML, or JSON, which is parsed as YAML too.
+func parseSopsTree(data []byte) (SopsFile, error) {
+	var (
+		document yaml.Node
+		sopsFile SopsFile
+	)
+
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return sopsFile, err
+	}
+
+	if len(document.Content) != 1 || document.Content[0].Kind != yaml.MappingNode {
+		return sopsFile, errors.New("expected mapping at top level")
+	}
+
+	mapping := document.Content[0].Content
+	hasMetadata := false
+
+	for i := 0; i+1 < len(mapping); i += 2 {
+		keyNode, valueNode := mapping[i], mapping[i+1]
+
+		if keyNode.Value == "sops" {
+			if err := valueNode.Decode(&sopsFile.Metadata); err != nil {
+				return sopsFile, fmt.Errorf("parsing sops metadata: %w", err)
+			}
+
+			hasMetadata = true
+
+			continue
+		}
+
+		valueType, ok := map[string]string{"!!str": "str", "!!int": "int", "!!float": "float", "!!bool": "bool"}[valueNode.Tag]
+		if valueNode.Kind != yaml.ScalarNode || !ok {
+			return sopsFile, fmt.Errorf("unsupported value type for `%s`", keyNode.Value)
+		}
+
+		sopsFile.Values = append(sopsFile.Values, sopsValue{Name: keyNode.Value, Value: valueNode.Value, Type: valueType})
+	}
+
+	if !hasMetadata {
+		return sopsFile, errors.New("missing sops metadata")
+	}
+
+	return sopsFile, nil
+}
+
+// parseSopsDotenv reads SOPS encrypted dotenv file, in which metadata is flattened into `sops_` variables, and new
+// lines are escaped.
+func parseSopsDotenv(data []byte) (SopsFile, error) {
+	var sopsFile SopsFile
+
+	hasMetadata := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		envName, envValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return sopsFile, fmt.Errorf("invalid dotenv line `%s`", envName)
+		}
+
+		envValue = strings.ReplaceAll(envValue, `\n`, "\n")
+
+		if !strings.HasPrefix(envName, "sops_") {
+			sopsFile.Values = append(sopsFile.Values, sopsValue{Name: envName, Value: envValue, Type: "str"})
+
+			continue
+		}
+
+		hasMetadata = true
+
+		switch envName {
+		case "sops_lastmodified":
+			sopsFile.Metadata.LastModified = envValue
+		case "sops_mac":
+			sopsFile.Metadata.MAC = envValue
+		case "sops_unencrypted_suffix":
+			sopsFile.Metadata.UnencryptedSuffix = envValue
+		case "sops_encrypted_suffix":
+			sopsFile.Metadata.EncryptedSuffix = envValue
+		case "sops_unencrypted_regex":
+			sopsFile.Metadata.UnencryptedRegex = envValue
+		case "sops_encrypted_regex":
+			sopsFile.Metadata.EncryptedRegex = envValue
+		case "sops_unencrypted_comment_regex":
+			sopsFile.Metadata.UnencryptedCommentRegex = envValue
+		case "sops_encrypted_comment_regex":
+			sopsFile.Metadata.EncryptedCommentRegex = envValue
+		case "sops_mac_only_encrypted":
+			sopsFile.Metadata.MACOnlyEncrypted, _ = strconv.ParseBool(envValue)
+		default:
+			if sopsDotenvAgeRegex.MatchString(envName) {
+				sopsFile.Metadata.Age = append(sopsFile.Metadata.Age, sopsAgeKey{Enc: envValue})
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return sopsFile, err
+	}
+
+	if !hasMetadata {
+		return sopsFile, errors.New("missing sops metadata")
+	}
+
+	return sopsFile, nil
+}
+
+// dataKey decrypts data key of the file, with the first age identity matching one of recipients.
+func (sf SopsFile) dataKey(identities []age.Identity) ([]byte, error) {
+	if len(sf.Metadata.Age) == 0 {
+		return nil, errors.New("no age recipients in sops metadata")
+	}
+
+	var err error
+
+	for _, ageKey := range sf.Metadata.Age {
+		var dataKey []byte
+		if dataKey, err = decryptAge([]byte(ageKey.Enc), identities); err == nil {
+			return dataKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("decrypting data key: %w", err)
+}
+
+// decryptSopsValue opens AES-GCM encrypted value, authenticated with its path in the file.
+func decryptSopsValue(value string, dataKey []byte, additionalData string) (string, string, error) {
+	matches := sopsEncryptedRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return "", "", errors.New("invalid encrypted value")
+	}
+
+	parts := make([][]byte, 3)
+
+	for i, encodedPart := range matches[1:4] {
+		part, err := base64.StdEncoding.DecodeString(encodedPart)
+		if err != nil {
+			return "", "", errors.New("invalid encrypted value")
+		}
+
+		parts[i] = part
+	}
+
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", "", err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", "", errors.New("authentication failed")
+	}
+
+	return string(plaintext), matches[4], nil
+}
+
+// sopsMACBytes returns value the way SOPS hashes it, which differs from plaintext for booleans.
+func sopsMACBytes(value, valueType string) ([]byte, error) {
+	switch valueType {
+	case "bool":
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if boolValue {
+			return []byte("True"), nil
+		}
+
+		return []byte("False"), nil
+	case "int":
+		intValue, err := strconv.Atoi(value)
+
+		return []byte(strconv.Itoa(intValue)), err
+	case "float":
+		floatValue, err := strconv.ParseFloat(value, 64)
+
+		return []byte(strconv.FormatFloat(floatValue, 'f', -1, 64)), err
+	default:
+		return []byte(value), nil
+	}
+}
+
+// Decrypt returns plaintext variables, after verifying the MAC. Whether a value is encrypted is decided by the SOPS
+// rules from metadata only, so a plaintext value cannot be slipped in where an encrypted one is expected.
+func (sf SopsFile) Decrypt(identities []age.Identity) ([]EnvVar, error) {
+	if err := sf.Metadata.checkRules(); err != nil {
+		return nil, err
+	}
+
+	dataKey, err := sf.dataKey(identities)
+	if err != nil {
+		return nil, err
+	}
+
+	envVars := make([]EnvVar, 0, len(sf.Values))
+	hash := sha512.New()
+
+	if sf.Metadata.MACOnlyEncrypted {
+		hash.Write(sopsMACOnlyEncryptedInit)
+	}
+
+	for _, value := range sf.Values {
+		if err := validateEnvName(value.Name); err != nil {
+			return nil, err
+		}
+
+		envValue, valueType := value.Value, value.Type
+		encrypted := sf.Metadata.shouldBeEncrypted(value.Name)
+
+		if encrypted && !sopsEncryptedRegex.MatchString(envValue) {
+			return nil, fmt.Errorf("value of `%s` is not encrypted", value.Name)
+		}
+
+		if encrypted {
+			if envValue, valueType, err = decryptSopsValue(envValue, dataKey, value.Name+":"); err != nil {
+				return nil, fmt.Errorf("decrypting `%s`: %w", value.Name, err)
+			}
+		}
+
+		macBytes, err := sopsMACBytes(envValue, valueType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value of `%s`", valueType, value.Name)
+		}
+
+		if encrypted || !sf.Metadata.MACOnlyEncrypted {
+			hash.Write(macBytes)
+		}
+
+		if valueType == "bool" {
+			envValue = strings.ToLower(string(macBytes))
+		}
+
+		envVars = append(envVars, EnvVar{Name: value.Name, Value: envValue})
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, sf.Metadata.LastModified)
+	if err != nil {
+		return nil, errors.New("invalid lastmodified in sops metadata")
+	}
+
+	mac, _, err := decryptSopsValue(sf.Metadata.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting MAC: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(mac), []byte(fmt.Sprintf("%X", hash.Sum(nil)))) != 1 {
+		return nil, errors.New("MAC mismatch")
+	}
+
+	return envVars, nil
+}
+
+// LoadSopsFile reads SOPS encrypted file, with format chosen by extension, the same way SOPS does: `.json`,
+// `.yaml`/`.yml`, and dotenv otherwise.
+func LoadSopsFile(path string) (SopsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SopsFile{}, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return parseSopsTree(data)
+	default:
+		return parseSopsDotenv(data)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+const sopsLastModified = "2024-05-01T10:00:00Z"
+
+func encryptSopsValue(t *testing.T, dataKey []byte, value, valueType, additionalData string) string {
+	t.Helper()
+
+	block, _ := aes.NewCipher(dataKey)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, 32)
+	iv := make([]byte, 32)
+	_, _ = rand.Read(iv)
+
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(additionalData))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv), base64.StdEncoding.EncodeToString(tag), valueType)
+}
+
+// writeSopsFile writes the same variables the way SOPS does for the format given by extension.
+func writeSopsFile(t *testing.T, name string, identity *age.X25519Identity, region string) string {
+	t.Helper()
+
+	dataKey := make([]byte, 32)
+	_, _ = rand.Read(dataKey)
+
+	encryptedDataKey, err := encryptAge(dataKey, []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatalf("error encrypting data key: %v", err)
+	}
+
+	isDotenv := filepath.Ext(name) == ".env"
+	port, debug, debugType, macDebug := encryptSopsValue(t, dataKey, "42", "int", "PORT:"), "", "bool", "True"
+
+	if isDotenv {
+		port, debugType, macDebug = encryptSopsValue(t, dataKey, "42", "str", "PORT:"), "str", "true"
+	}
+
+	debug = encryptSopsValue(t, dataKey, "true", debugType, "DEBUG:")
+	secret := encryptSopsValue(t, dataKey, "s3cr3t", "str", "SECRET:")
+	mac := fmt.Sprintf("%X", sha512.Sum512([]byte("s3cr3t"+"42"+macDebug+"eu")))
+	encryptedMAC := encryptSopsValue(t, dataKey, mac, "str", sopsLastModified)
+
+	var data string
+
+	switch filepath.Ext(name) {
+	case ".env":
+		data = "SECRET=" + secret + "\nPORT=" + port + "\nDEBUG=" + debug + "\nREGION_unencrypted=" + region + "\n" +
+			"sops_age__list_0__map_enc=" + strings.ReplaceAll(string(encryptedDataKey), "\n", `\n`) + "\n" +
+			"sops_age__list_0__map_recipient=" + identity.Recipient().String() + "\n" +
+			"sops_lastmodified=" + sopsLastModified + "\nsops_mac=" + encryptedMAC + "\n" +
+			"sops_unencrypted_suffix=_unencrypted\nsops_version=3.8.1\n"
+	case ".json":
+		quote := func(value string) string { quoted, _ := json.Marshal(value); return string(quoted) }
+		data = "{\n\t\"SECRET\": " + quote(secret) + ",\n\t\"PORT\": " + quote(port) + ",\n\t\"DEBUG\": " + quote(debug) +
+			",\n\t\"REGION_unencrypted\": " + quote(region) + ",\n\t\"sops\": {\n\t\t\"age\": [\n\t\t\t{\n" +
+			"\t\t\t\t\"recipient\": " + quote(identity.Recipient().String()) + ",\n" +
+			"\t\t\t\t\"enc\": " + quote(string(encryptedDataKey)) + "\n\t\t\t}\n\t\t],\n" +
+			"\t\t\"lastmodified\": " + quote(sopsLastModified) + ",\n\t\t\"mac\": " + quote(encryptedMAC) + ",\n" +
+			"\t\t\"unencrypted_suffix\": \"_unencrypted\",\n\t\t\"version\": \"3.8.1\"\n\t}\n}\n"
+	default:
+		data = "SECRET: " + secret + "\nPORT: " + port + "\nDEBUG: " + debug + "\nREGION_unencrypted: " + region + "\n" +
+			"sops:\n    age:\n        - recipient: " + identity.Recipient().String() + "\n          enc: |\n" +
+			"            " + strings.ReplaceAll(strings.TrimSpace(string(encryptedDataKey)), "\n", "\n            ") + "\n" +
+			"    lastmodified: \"" + sopsLastModified + "\"\n    mac: " + encryptedMAC + "\n" +
+			"    unencrypted_suffix: _unencrypted\n    version: 3.8.1\n"
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("error writing sops file: %v", err)
+	}
+
+	return path
+}
+
+func Test_SopsFileDecrypt(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	otherIdentity, _ := age.GenerateX25519Identity()
+	expectedEnvVars := []EnvVar{{"SECRET", "s3cr3t"}, {"PORT", "42"}, {"DEBUG", "true"}, {"REGION_unencrypted", "eu"}}
+
+	for _, name := range []string{"secrets.env", "secrets.json", "secrets.yaml"} {
+		t.Run("it decrypts "+name, func(t *testing.T) {
+			sopsFile, err := LoadSopsFile(writeSopsFile(t, name, identity, "eu"))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			envVars, err := sopsFile.Decrypt([]age.Identity{identity})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if fmt.Sprint(envVars) != fmt.Sprint(expectedEnvVars) {
+				t.Errorf("expected %v, got %v", expectedEnvVars, envVars)
+			}
+		})
+
+		t.Run("it fails on tampered "+name, func(t *testing.T) {
+			sopsFile, _ := LoadSopsFile(writeSopsFile(t, name, identity, "us"))
+
+			if _, err := sopsFile.Decrypt([]age.Identity{identity}); err == nil || err.Error() != "MAC mismatch" {
+				t.Errorf("expected MAC mismatch, got %v", err)
+			}
+		})
+
+		t.Run("it fails with wrong identity for "+name, func(t *testing.T) {
+			sopsFile, _ := LoadSopsFile(writeSopsFile(t, name, identity, "eu"))
+
+			if _, err := sopsFile.Decrypt([]age.Identity{otherIdentity}); err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+
+	t.Run("it fails on value moved to other key", func(t *testing.T) {
+		path := writeSopsFile(t, "secrets.yaml", identity, "eu")
+		data, _ := os.ReadFile(path)
+		_ = os.WriteFile(path, bytes.Replace(data, []byte("SECRET:"), []byte("OTHER:"), 1), 0600)
+
+		sopsFile, _ := LoadSopsFile(path)
+		if _, err := sopsFile.Decrypt([]age.Identity{identity}); err == nil || !strings.Contains(err.Error(), "OTHER") {
+			t.Errorf("expected decryption error, got %v", err)
+		}
+	})
+
+	t.Run("it fails on nested values", func(t *testing.T) {
+		if _, err := parseSopsTree([]byte("A:\n  B: c\nsops: {}\n")); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	})
+
+	t.Run("it fails without metadata", func(t *testing.T) {
+		if _, err := parseSopsDotenv([]byte("A=b\n")); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	})
+}
+
+// loadSopsFixture reads file encrypted by the sops binary (3.9.0) from testdata, optionally modified by tamper.
+func loadSopsFixture(t *testing.T, name string, tamper func(string) string) (SopsFile, []age.Identity) {
+	t.Helper()
+
+	keyData, err := os.ReadFile(filepath.Join("testdata", "sops", "age.key"))
+	if err != nil {
+		t.Fatalf("error reading age key: %v", err)
+	}
+
+	identity, err := age.ParseX25519Identity(strings.TrimSpace(string(keyData)))
+	if err != nil {
+		t.Fatalf("error parsing age key: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "sops", name))
+	if err != nil {
+		t.Fatalf("error reading sops file: %v", err)
+	}
+
+	if tamper != nil {
+		data = []byte(tamper(string(data)))
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("error writing sops file: %v", err)
+	}
+
+	sopsFile, err := LoadSopsFile(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return sopsFile, []age.Identity{identity}
+}
+
+func Test_SopsFileDecryptFixtures(t *testing.T) {
+	for name, expectedEnvVars := range map[string][]EnvVar{
+		"secrets.env":  {{"DB_PASSWORD", "s3cr3t"}, {"API_TOKEN", "multi\nline"}, {"LOG_LEVEL_unencrypted", "debug"}},
+		"maconly.env":  {{"DB_PASSWORD", "s3cr3t"}, {"API_TOKEN", "multi\nline"}, {"LOG_LEVEL_unencrypted", "debug"}},
+		"regex.env":    {{"DB_PASSWORD", "s3cr3t"}, {"LOG_LEVEL", "debug"}},
+		"secrets.json": {{"DB_PASSWORD", "s3cr3t"}, {"PORT", "5432"}, {"DEBUG", "true"}, {"RATIO", "1.5"}, {"LOG_LEVEL_unencrypted", "debug"}},
+		"secrets.yaml": {{"DB_PASSWORD", "s3cr3t"}, {"PORT", "5432"}, {"DEBUG", "false"}, {"LOG_LEVEL_unencrypted", "debug"}},
+	} {
+		t.Run("it decrypts "+name+" written by sops", func(t *testing.T) {
+			sopsFile, identities := loadSopsFixture(t, name, nil)
+
+			envVars, err := sopsFile.Decrypt(identities)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if fmt.Sprint(envVars) != fmt.Sprint(expectedEnvVars) {
+				t.Errorf("expected %v, got %v", expectedEnvVars, envVars)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name          string
+		file          string
+		tamper        func(string) string
+		expectedError string
+	}{
+		{
+			"it refuses plaintext variable added to file",
+			"secrets.env",
+			func(data string) string { return "LD_PRELOAD=/tmp/evil.so\n" + data },
+			"value of `LD_PRELOAD` is not encrypted",
+		},
+		{
+			"it refuses plaintext variable added to file authenticating encrypted values only",
+			"maconly.env",
+			func(data string) string { return "INJECTED=evil\n" + data },
+			"value of `INJECTED` is not encrypted",
+		},
+		{
+			"it refuses encrypted value replaced with plaintext",
+			"maconly.env",
+			func(data string) string {
+				return regexp.MustCompile(`(?m)^DB_PASSWORD=.*$`).ReplaceAllString(data, "DB_PASSWORD=evil")
+			},
+			"value of `DB_PASSWORD` is not encrypted",
+		},
+		{
+			"it refuses MAC restricted to encrypted values afterwards",
+			"secrets.env",
+			func(data string) string { return data + "sops_mac_only_encrypted=true\n" },
+			"MAC mismatch",
+		},
+		{
+			"it refuses changed value left unencrypted by rule",
+			"regex.env",
+			func(data string) string { return strings.Replace(data, "LOG_LEVEL=debug", "LOG_LEVEL=evil", 1) },
+			"MAC mismatch",
+		},
+		{
+			"it refuses additional encryption rule",
+			"secrets.env",
+			func(data string) string { return data + "sops_unencrypted_regex=.*\n" },
+			"more than one encryption rule in sops metadata",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sopsFile, identities := loadSopsFixture(t, tt.file, tt.tamper)
+
+			if _, err := sopsFile.Decrypt(identities); err == nil || err.Error() != tt.expectedError {
+				t.Errorf("expected %q error, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCmd_Sops(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	identity, identityPath := writeAgeIdentity(t)
+
+	t.Run("it merges sops variables into environment", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		dir := writeEnvDir(t, map[string]string{"PORT": "80\n", "HOST": "localhost\n"})
+		sopsPaths := writeSopsFile(t, "secrets.yaml", identity, "eu") + string(os.PathListSeparator) +
+			writeSopsFile(t, "secrets.env", identity, "eu")
+
+		os.Args = []string{"envdir", "-d", dir, "-ll", "debug", "--age-identity", identityPath, "--sops", sopsPaths,
+			"sh", "-c", `echo "$HOST $PORT $SECRET"`}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.HasSuffix(cmdStdout.String(), "localhost 42 s3cr3t\n") || strings.Count(cmdStdout.String(), "s3cr3t") != 1 {
+			t.Errorf("expected sops variables, which are not logged, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it fails on tampered file", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		sopsPath := writeSopsFile(t, "secrets.json", identity, "us")
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--age-identity", identityPath, "--sops", sopsPath, "true"}
+		if exitCode := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr).Execute(); exitCode != 3 {
+			t.Errorf("expected env error exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if !strings.Contains(cmdStdout.String(), sopsPath) || !strings.Contains(cmdStdout.String(), "MAC mismatch") {
+			t.Errorf("expected file name and MAC mismatch in log, got:\n%s", cmdStdout.String())
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+type UserSpec struct {
+	Name   string
+	Home   string
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+}
+
+func parseID(id string) (uint32, error) {
+	parsedID, err := strconv.ParseUint(id, 10, 32)
+
+	return uint32(parsedID), err
+}
+
+func resolveGroup(group string) (uint32, error) {
+	if gid, err := parseID(group); err == nil {
+		return gid, nil
+	}
+
+	userGroup, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseID(userGroup.Gid)
+}
+
+// resolveUser parses `name|uid[:group|gid]` the same way su-exec does. Without explicit group, primary and
+// supplementary groups of the user are used. A numeric uid missing from /etc/passwd gets a gid equal to uid
+// and `/` as home directory.
+func resolveUser(spec string) (UserSpec, error) {
+	userName, group, hasGroup := strings.Cut(spec, ":")
+	userSpec := UserSpec{Home: "/"}
+
+	passwdUser, err := user.Lookup(userName)
+	if err != nil {
+		passwdUser, err = user.LookupId(userName)
+	}
+
+	if err == nil {
+		userSpec.Name, userSpec.Home = passwdUser.Username, passwdUser.HomeDir
+
+		if userSpec.UID, err = parseID(passwdUser.Uid); err != nil {
+			return UserSpec{}, fmt.Errorf("invalid uid of user `%s`: %w", userName, err)
+		}
+
+		if userSpec.GID, err = parseID(passwdUser.Gid); err != nil {
+			return UserSpec{}, fmt.Errorf("invalid gid of user `%s`: %w", userName, err)
+		}
+	} else {
+		uid, err := parseID(userName)
+		if err != nil {
+			return UserSpec{}, fmt.Errorf("unknown user `%s`", userName)
+		}
+
+		passwdUser = nil
+		userSpec.UID, userSpec.GID = uid, uid
+	}
+
+	if hasGroup {
+		if userSpec.GID, err = resolveGroup(group); err != nil {
+			return UserSpec{}, fmt.Errorf("unknown group `%s`", group)
+		}
+	}
+
+	userSpec.Groups = []uint32{userSpec.GID}
+
+	if passwdUser != nil && !hasGroup {
+		groupIDs, err := passwdUser.GroupIds()
+		if err != nil {
+			return UserSpec{}, fmt.Errorf("reading groups of user `%s`: %w", userName, err)
+		}
+
+		for _, groupID := range groupIDs {
+			if gid, err := parseID(groupID); err == nil && gid != userSpec.GID {
+				userSpec.Groups = append(userSpec.Groups, gid)
+			}
+		}
+	}
+
+	return userSpec, nil
+}
+
+// setupUser makes the subprocess run as a different user, with HOME, USER and LOGNAME updated accordingly, USER and
+// LOGNAME set to the numeric uid when it is missing from /etc/passwd. The credentials are applied by the kernel when
+// the subprocess is started, after envdir has read the directory.
+func setupUser(cmd *exec.Cmd, spec string, logger *Logger) error {
+	userSpec, err := resolveUser(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := setCredential(cmd, userSpec); err != nil {
+		return err
+	}
+
+	userName := userSpec.Name
+	if userName == "" {
+		userName = strconv.FormatUint(uint64(userSpec.UID), 10)
+	}
+
+	cmd.Env = append(cmd.Env, "HOME="+userSpec.Home, "USER="+userName, "LOGNAME="+userName)
+
+	logger.Info("dropping privileges", LogFields{"uid": userSpec.UID, "gid": userSpec.GID, "groups": userSpec.Groups})
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setCredential(_ *exec.Cmd, _ UserSpec) error {
+	return errors.New("switching user is not supported on this platform")
+}
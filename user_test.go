@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_ResolveUser(t *testing.T) {
+	var tests = []struct {
+		spec         string
+		expectedName string
+		expectedHome string
+		expectedUID  uint32
+		expectedGID  uint32
+	}{
+		{"root", "root", "/root", 0, 0},
+		{"0", "root", "/root", 0, 0},
+		{"root:1234", "root", "/root", 0, 1234},
+		{"4321", "", "/", 4321, 4321},
+		{"4321:root", "", "/", 4321, 0},
+	}
+
+	for _, tt := range tests {
+		userSpec, err := resolveUser(tt.spec)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.spec, err)
+
+			continue
+		}
+
+		if userSpec.Name != tt.expectedName || userSpec.Home != tt.expectedHome || userSpec.UID != tt.expectedUID || userSpec.GID != tt.expectedGID {
+			t.Errorf("invalid user for %q: %+v", tt.spec, userSpec)
+		}
+
+		if userSpec.Groups[0] != tt.expectedGID {
+			t.Errorf("expected primary group to be first supplementary group for %q, got %v", tt.spec, userSpec.Groups)
+		}
+	}
+
+	for _, spec := range []string{"non-existing-user", "root:non-existing-group", "-1"} {
+		if _, err := resolveUser(spec); err == nil {
+			t.Errorf("expected error for %q, got none", spec)
+		}
+	}
+}
+
+func TestCmd_User(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it runs command as different user", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		if os.Geteuid() != 0 {
+			t.Skip("switching user requires root")
+		}
+
+		t.Setenv("USER", "root")
+		t.Setenv("LOGNAME", "root")
+		os.Args = []string{"envdir", "-d", t.TempDir(), "--user", "4321:4322", "sh", "-c", `echo "$(id -u):$(id -g):$(id -G):$HOME:$USER:$LOGNAME"`}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStdout.String())
+		}
+
+		if cmdStdout.String() != "4321:4322:4322:/:4321:4321\n" {
+			t.Errorf("expected command to run as dropped user, got:\n%s", cmdStdout.String())
+		}
+	})
+
+	t.Run("it refuses to run command if user cannot be switched", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "-d", t.TempDir(), "-u", "non-existing-user", "true"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 1 {
+			t.Errorf("expected error exit code, got %d", exitCode)
+		}
+
+		if !strings.Contains(cmdStdout.String(), `msg="error setting up subprocess" err="switching user: unknown user `+"`non-existing-user`"+`"`) {
+			t.Errorf("expected error about switching user, got:\n%s", cmdStdout.String())
+		}
+	})
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setCredential(cmd *exec.Cmd, userSpec UserSpec) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: userSpec.UID, Gid: userSpec.GID, Groups: userSpec.Groups}
+
+	return nil
+}
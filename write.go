@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+type fileModeValue os.FileMode
+
+func (m *fileModeValue) String() string {
+	return fmt.Sprintf("%04o", uint32(*m))
+}
+
+func (m *fileModeValue) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("invalid file mode %q", value)
+	}
+
+	*m = fileModeValue(mode)
+
+	return nil
+}
+
+func (c Cmd) dirFlag(flagSet *flag.FlagSet, dir *string) {
+	flags := &Flags{}
+	flagSet.StringVar(dir, "d", flags.Getenv("ENVDIR_DIRECTORY", "/secrets"), "Directory to write files to")
+}
+
+// readValue prompts for a value without echo if stdin is a terminal, otherwise reads the whole stdin and removes
+// a single trailing newline, the same way envdir does for files.
+func (c Cmd) readValue(envName string) (string, error) {
+	if stdinFile, ok := c.Stdin.(*os.File); ok && term.IsTerminal(int(stdinFile.Fd())) {
+		_, _ = c.Stderr.Write([]byte("Value for " + envName + ": "))
+		envValue, err := term.ReadPassword(int(stdinFile.Fd()))
+		_, _ = c.Stderr.Write([]byte("\n"))
+
+		return string(envValue), err
+	}
+
+	envData, err := io.ReadAll(c.Stdin)
+
+	return strings.TrimSuffix(string(envData), "\n"), err
+}
+
+func writeEnvVars(dir string, envVars []EnvVar, mode os.FileMode, logger *Logger) error {
+	for _, envVar := range envVars {
+		if err := validateEnvName(envVar.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating env directory: %w", err)
+	}
+
+	// files of a published directory are read through `..data`, so a new snapshot has to be published instead
+	published := isDataDirLayout(dir)
+	if published {
+		if err := updateDataDir(dir, envDataFiles(envVars, mode), nil, logger); err != nil {
+			return err
+		}
+	}
+
+	for _, envVar := range envVars {
+		if !published {
+			if err := writeFileAtomic(filepath.Join(dir, envVar.Name), encodeEnvValue(envVar.Value), mode); err != nil {
+				return err
+			}
+		}
+
+		logger.Info("wrote variable to directory", LogFields{"name": envVar.Name, "dir": dir})
+	}
+
+	return nil
+}
+
+// Set writes a single variable to an env directory. The value is taken from the argument, stdin or an interactive
+// prompt, in that order.
+func (c Cmd) Set(args []string) int {
+	var dir string
+
+	mode := fileModeValue(0600)
+	flagSet := c.newSubcommandFlagSet("set")
+	c.dirFlag(flagSet, &dir)
+	flagSet.Var(&mode, "m", "Permissions of written files (octal)")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if flagSet.NArg() < 1 || flagSet.NArg() > 2 {
+		logger.Error("set requires variable name and optional value", LogFields{"args": flagSet.Args()})
+
+		return 2
+	}
+
+	envVar := EnvVar{Name: flagSet.Arg(0), Value: flagSet.Arg(1)}
+
+	if err := validateEnvName(envVar.Name); err != nil {
+		logger.Error("error validating variable", LogFields{"err": err.Error()})
+
+		return 2
+	}
+
+	if flagSet.NArg() == 1 {
+		envValue, err := c.readValue(envVar.Name)
+		if err != nil {
+			logger.Error("error reading value", LogFields{"err": err.Error()})
+
+			return 1
+		}
+
+		envVar.Value = envValue
+	}
+
+	if err := writeEnvVars(dir, []EnvVar{envVar}, os.FileMode(mode), logger); err != nil {
+		logger.Error("error writing variables to directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	return 0
+}
+
+// Unset removes variables from an env directory. Removing a variable which is not set is not an error.
+func (c Cmd) Unset(args []string) int {
+	var dir string
+
+	flagSet := c.newSubcommandFlagSet("unset")
+	c.dirFlag(flagSet, &dir)
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if flagSet.NArg() < 1 {
+		logger.Error("unset requires at least one variable name", LogFields{})
+
+		return 2
+	}
+
+	for _, envName := range flagSet.Args() {
+		if err := validateEnvName(envName); err != nil {
+			logger.Error("error validating variable", LogFields{"err": err.Error()})
+
+			return 2
+		}
+	}
+
+	if isDataDirLayout(dir) {
+		if err := updateDataDir(dir, nil, flagSet.Args(), logger); err != nil {
+			logger.Error("error removing variable from directory", LogFields{"err": err.Error()})
+
+			return 3
+		}
+
+		return 0
+	}
+
+	for _, envName := range flagSet.Args() {
+		err := os.Remove(filepath.Join(dir, envName))
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			logger.Info("variable is not set", LogFields{"name": envName, "dir": dir})
+		case err != nil:
+			logger.Error("error removing variable from directory", LogFields{"err": err.Error()})
+
+			return 3
+		default:
+			logger.Info("removed variable from directory", LogFields{"name": envName, "dir": dir})
+		}
+	}
+
+	return 0
+}
+
+// Import writes all variables from a dotenv or JSON file, or from the current environment, to an env directory.
+func (c Cmd) Import(args []string) int {
+	var dir, format string
+
+	mode := fileModeValue(0600)
+	flagSet := c.newSubcommandFlagSet("import")
+	c.dirFlag(flagSet, &dir)
+	flagSet.Var(&mode, "m", "Permissions of written files (octal)")
+	flagSet.StringVar(&format, "format", "", "Input format (dotenv/json/env), detected from file extension by default")
+
+	if exitCode, ok := c.parseSubcommandFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	logger := c.subcommandLogger()
+
+	if flagSet.NArg() > 1 || (format == "env" && flagSet.NArg() > 0) {
+		logger.Error("import accepts at most one input file", LogFields{"args": flagSet.Args()})
+
+		return 2
+	}
+
+	envVars, err := c.importEnvVars(flagSet.Arg(0), format)
+	if errors.Is(err, errInvalidImportFormat) {
+		logger.Error("invalid import format", LogFields{"format": format})
+
+		return 2
+	}
+
+	if err != nil {
+		logger.Error("error reading variables to import", LogFields{"err": err.Error()})
+
+		return 1
+	}
+
+	if err := writeEnvVars(dir, envVars, os.FileMode(mode), logger); err != nil {
+		logger.Error("error writing variables to directory", LogFields{"err": err.Error()})
+
+		return 3
+	}
+
+	return 0
+}
+
+var errInvalidImportFormat = errors.New("invalid import format")
+
+func (c Cmd) importEnvVars(inputPath, format string) ([]EnvVar, error) {
+	if format == "env" {
+		envVars := make([]EnvVar, 0)
+
+		for _, envLine := range os.Environ() {
+			envName, envValue, _ := strings.Cut(envLine, `=`)
+			envVars = append(envVars, EnvVar{Name: envName, Value: envValue})
+		}
+
+		return envVars, nil
+	}
+
+	if format == "" {
+		format = "dotenv"
+		if filepath.Ext(inputPath) == ".json" {
+			format = "json"
+		}
+	}
+
+	var parse func(io.Reader) ([]EnvVar, error)
+
+	switch format {
+	case "dotenv":
+		parse = parseDotenv
+	case "json":
+		parse = parseJSONEnv
+	default:
+		return nil, errInvalidImportFormat
+	}
+
+	if inputPath == "" || inputPath == "-" {
+		return parse(c.Stdin)
+	}
+
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer inputFile.Close()
+
+	return parse(inputFile)
+}
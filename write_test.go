@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func assertEnvFile(t *testing.T, envPath, expectedValue string, expectedMode os.FileMode) {
+	t.Helper()
+
+	envFile, err := readEnvFile(envPath)
+	if err != nil {
+		t.Fatalf("expected env file to be written, got error %v", err)
+	}
+
+	if envFile.Value() != expectedValue {
+		t.Errorf("invalid value in %s: expected %q, got %q", envPath, expectedValue, envFile.Value())
+	}
+
+	if envFileInfo, _ := os.Stat(envPath); envFileInfo.Mode().Perm() != expectedMode {
+		t.Errorf("invalid permissions of %s: expected %v, got %v", envPath, expectedMode, envFileInfo.Mode().Perm())
+	}
+}
+
+func TestCmd_Set(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envDir := filepath.Join(t.TempDir(), "env")
+
+	t.Run("it writes value from argument", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		os.Args = []string{"envdir", "@set", "-d", envDir, "-m", "0640", "LOREM", "ipsum\n"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "LOREM"), "ipsum\n", 0640)
+	})
+
+	t.Run("it writes value from stdin", func(t *testing.T) {
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		t.Setenv("ENVDIR_DIRECTORY", envDir)
+		os.Args = []string{"envdir", "@set", "DOLOR"}
+
+		cmd := NewCmd(strings.NewReader("sit amet\n"), &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "DOLOR"), "sit amet", 0600)
+	})
+
+	t.Run("it fails on invalid arguments", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		for _, args := range [][]string{
+			{"envdir", "@set", "-d", envDir},
+			{"envdir", "@set", "-d", envDir, "../ESCAPE", "value"},
+			{"envdir", "@set", "-d", envDir, "-m", "999", "LOREM", "value"},
+		} {
+			os.Args = args
+
+			cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != 2 {
+				t.Errorf("expected usage error exit code for %v, got %d", args, exitCode)
+			}
+		}
+	})
+}
+
+func TestCmd_Unset(t *testing.T) {
+	var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envDir := writeEnvDir(t, map[string]string{"LOREM": "ipsum", "DOLOR": "sit"})
+	os.Args = []string{"envdir", "@unset", "-d", envDir, "LOREM", "MISSING"}
+
+	cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+	if exitCode := cmd.Execute(); exitCode != 0 {
+		t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+	}
+
+	envFiles, _ := readEnvDir(envDir)
+	if len(envFiles) != 1 || envFiles[0].Name != "DOLOR" {
+		t.Errorf("expected only DOLOR to be left, got %v", envFiles)
+	}
+}
+
+func TestCmd_Import(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("it imports dotenv from stdin", func(t *testing.T) {
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := t.TempDir()
+		os.Args = []string{"envdir", "@import", "-d", envDir}
+
+		cmd := NewCmd(strings.NewReader("LOREM=ipsum\nexport DOLOR=\"sit\\namet\"\n"), &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "LOREM"), "ipsum", 0600)
+		assertEnvFile(t, filepath.Join(envDir, "DOLOR"), "sit\namet", 0600)
+	})
+
+	t.Run("it imports json file", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := t.TempDir()
+		jsonPath := filepath.Join(t.TempDir(), "secrets.json")
+		if err := os.WriteFile(jsonPath, []byte(`{"LOREM": "ipsum", "ANSWER": 42}`), 0600); err != nil {
+			t.Fatalf("error creating json file: %v", err)
+		}
+
+		os.Args = []string{"envdir", "@import", "-d", envDir, "-m", "0644", jsonPath}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "LOREM"), "ipsum", 0644)
+		assertEnvFile(t, filepath.Join(envDir, "ANSWER"), "42", 0644)
+	})
+
+	t.Run("it imports current environment", func(t *testing.T) {
+		var cmdStdin, cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := t.TempDir()
+		t.Setenv("VAR_FROM_PARENT", "value-from-parent")
+		os.Args = []string{"envdir", "@import", "-d", envDir, "-format", "env"}
+
+		cmd := NewCmd(&cmdStdin, &cmdStdout, &cmdStderr)
+		if exitCode := cmd.Execute(); exitCode != 0 {
+			t.Errorf("expected success exit code, got %d:\n%s", exitCode, cmdStderr.String())
+		}
+
+		assertEnvFile(t, filepath.Join(envDir, "VAR_FROM_PARENT"), "value-from-parent", 0600)
+	})
+
+	t.Run("it fails on invalid input", func(t *testing.T) {
+		var cmdStdout, cmdStderr bytes.Buffer
+
+		envDir := t.TempDir()
+
+		for _, tt := range []struct {
+			args     []string
+			exitCode int
+		}{
+			{[]string{"envdir", "@import", "-d", envDir, "-format", "yaml"}, 2},
+			{[]string{"envdir", "@import", "-d", envDir, "/non-existing-file"}, 1},
+			{[]string{"envdir", "@import", "-d", envDir}, 1},
+		} {
+			os.Args = tt.args
+
+			cmd := NewCmd(strings.NewReader("invalid line"), &cmdStdout, &cmdStderr)
+			if exitCode := cmd.Execute(); exitCode != tt.exitCode {
+				t.Errorf("expected exit code %d for %v, got %d", tt.exitCode, tt.args, exitCode)
+			}
+		}
+
+		if envFiles, _ := os.ReadDir(envDir); len(envFiles) != 0 {
+			t.Errorf("expected nothing to be written, got %v", envFiles)
+		}
+	})
+}